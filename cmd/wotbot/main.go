@@ -7,8 +7,16 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/L11R/wotbot/internal/infra/cache"
 	"github.com/L11R/wotbot/internal/infra/database"
+	"github.com/L11R/wotbot/internal/infra/httpclient"
 	"github.com/L11R/wotbot/internal/infra/kttc"
+	"github.com/L11R/wotbot/internal/infra/metrics"
+	"github.com/L11R/wotbot/internal/infra/notifier"
+	"github.com/L11R/wotbot/internal/infra/ratelimit"
+	"github.com/L11R/wotbot/internal/infra/rating"
+	"github.com/L11R/wotbot/internal/infra/scale"
+	"github.com/L11R/wotbot/internal/infra/scheduler"
 
 	"github.com/L11R/wotbot/internal/configs"
 	"github.com/L11R/wotbot/internal/domain"
@@ -45,23 +53,72 @@ func main() {
 	if err != nil {
 		logger.Fatal("Error creating new database adapter!", zap.Error(err))
 	}
-	ws := wargaming.NewAdapter(logger, config.Wargaming)
-	x := xvm.NewAdapter(logger, config.XVM)
-	k := kttc.NewAdapter(logger, config.KTTC)
+	ch, err := cache.NewAdapter(logger, config.Cache, db)
+	if err != nil {
+		logger.Fatal("Error creating new cache adapter!", zap.Error(err))
+	}
+
+	// Upstream adapters share HTTP client with retries and circuit breakers, they are wrapped with cache,
+	// service doesn't know about both
+	hc := httpclient.New(logger, config.HTTP)
+	ws := ch.Wargaming(wargaming.NewAdapter(logger, config.Wargaming, hc))
+	x := ch.XVM(xvm.NewAdapter(logger, config.XVM, hc))
+	k := ch.KTTC(kttc.NewAdapter(logger, config.KTTC, hc))
+	r := rating.NewAdapter(logger, config.Rating)
+	sc, err := scale.NewAdapter(logger, config.Scale)
+	if err != nil {
+		logger.Fatal("Error loading rating scales!", zap.Error(err))
+	}
 
-	service := domain.NewService(logger, db, ws, x, k)
+	service := domain.NewService(logger, config.Service, db, ws, x, k, r, sc)
 
-	ts, err := telegram.NewAdapter(logger, config.Telegram, service)
+	limiter, err := ratelimit.NewAdapter(logger, config.RateLimit)
+	if err != nil {
+		logger.Fatal("Error parsing rate limits!", zap.Error(err))
+	}
+
+	ts, err := telegram.NewAdapter(logger, config.Telegram, service, limiter)
 	if err != nil {
 		logger.Panic("Error creating new Telegram adapter!", zap.Error(err))
 	}
 
-	shutdown := make(chan error, 1)
+	// Both bot and metrics server may fail, buffer lets the second one exit without reader
+	shutdown := make(chan error, 2)
 
 	go func(shutdown chan<- error) {
 		shutdown <- ts.ListenAndServe()
 	}(shutdown)
 
+	var m metrics.Adapter
+	if config.Metrics.Enabled {
+		m = metrics.NewAdapter(logger, config.Metrics)
+		go func(shutdown chan<- error) {
+			if err := m.ListenAndServe(); err != nil {
+				shutdown <- err
+			}
+		}(shutdown)
+	}
+
+	// Automatic refresh is optional, users have to opt in as well
+	var sch scheduler.Adapter
+	if config.Scheduler.Enabled {
+		refresher := domain.NewRefresher(logger, config.Service, db, x)
+		sch, err = scheduler.NewAdapter(logger, config.Scheduler, scheduler.NewRefreshJob(refresher))
+		if err != nil {
+			logger.Fatal("Error creating scheduler!", zap.Error(err))
+		}
+		go sch.Run()
+	}
+
+	var ntf scheduler.Adapter
+	if config.Notifier.Enabled {
+		ntf, err = notifier.NewAdapter(logger, config.Notifier, service, ts)
+		if err != nil {
+			logger.Fatal("Error creating notifier!", zap.Error(err))
+		}
+		go ntf.Run()
+	}
+
 	// Graceful shutdown block
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
@@ -74,6 +131,16 @@ func main() {
 	}
 
 	logger.Info("Stopping bot...")
+	if sch != nil {
+		sch.Shutdown()
+	}
+	if ntf != nil {
+		ntf.Shutdown()
+	}
 	ts.Shutdown()
+	// Metrics are served until the end, so the drain is visible too
+	if m != nil {
+		m.Shutdown()
+	}
 	logger.Info("Bot stopped")
 }
@@ -3,8 +3,17 @@ package configs
 import (
 	"os"
 
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/infra/cache"
 	"github.com/L11R/wotbot/internal/infra/database"
+	"github.com/L11R/wotbot/internal/infra/httpclient"
 	"github.com/L11R/wotbot/internal/infra/kttc"
+	"github.com/L11R/wotbot/internal/infra/metrics"
+	"github.com/L11R/wotbot/internal/infra/notifier"
+	"github.com/L11R/wotbot/internal/infra/ratelimit"
+	"github.com/L11R/wotbot/internal/infra/rating"
+	"github.com/L11R/wotbot/internal/infra/scale"
+	"github.com/L11R/wotbot/internal/infra/scheduler"
 	"github.com/L11R/wotbot/internal/infra/telegram"
 	"github.com/L11R/wotbot/internal/infra/wargaming"
 	"github.com/L11R/wotbot/internal/infra/xvm"
@@ -12,11 +21,20 @@ import (
 )
 
 type Config struct {
-	Database  *database.Config  `group:"Database args" namespace:"database" env-namespace:"WOT_DATABASE"`
-	Telegram  *telegram.Config  `group:"Telegram args" namespace:"telegram" env-namespace:"WOT_TELEGRAM"`
-	Wargaming *wargaming.Config `group:"Wargaming args" namespace:"wargaming" env-namespace:"WOT_WARGAMING"`
-	XVM       *xvm.Config       `group:"XVM args" namespace:"xvm" env-namespace:"WOT_XVM"`
-	KTTC      *kttc.Config      `group:"KTTC args" namespace:"kttc" env-namespace:"WOT_KTTC"`
+	Service   *domain.Config     `group:"Service args" namespace:"service" env-namespace:"WOT_SERVICE"`
+	Database  *database.Config   `group:"Database args" namespace:"database" env-namespace:"WOT_DATABASE"`
+	Telegram  *telegram.Config   `group:"Telegram args" namespace:"telegram" env-namespace:"WOT_TELEGRAM"`
+	Wargaming *wargaming.Config  `group:"Wargaming args" namespace:"wargaming" env-namespace:"WOT_WARGAMING"`
+	XVM       *xvm.Config        `group:"XVM args" namespace:"xvm" env-namespace:"WOT_XVM"`
+	KTTC      *kttc.Config       `group:"KTTC args" namespace:"kttc" env-namespace:"WOT_KTTC"`
+	Rating    *rating.Config     `group:"Rating args" namespace:"rating" env-namespace:"WOT_RATING"`
+	Scale     *scale.Config      `group:"Rating scales args" namespace:"scale" env-namespace:"WOT_SCALE"`
+	Scheduler *scheduler.Config  `group:"Scheduler args" namespace:"scheduler" env-namespace:"WOT_SCHEDULER"`
+	Notifier  *notifier.Config   `group:"Notifier args" namespace:"notifier" env-namespace:"WOT_NOTIFIER"`
+	RateLimit *ratelimit.Config  `group:"Rate limit args" namespace:"ratelimit" env-namespace:"WOT_RATELIMIT"`
+	Cache     *cache.Config      `group:"Cache args" namespace:"cache" env-namespace:"WOT_CACHE"`
+	HTTP      *httpclient.Config `group:"HTTP client args" namespace:"http" env-namespace:"WOT_HTTP"`
+	Metrics   *metrics.Config    `group:"Metrics args" namespace:"metrics" env-namespace:"WOT_METRICS"`
 
 	Verbose []bool `short:"v" long:"verbose" env:"WOT_VERBOSE" description:"Verbose logs"`
 }
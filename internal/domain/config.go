@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+type Config struct {
+	DefaultRegion     Region        `long:"default-region" env:"DEFAULT_REGION" description:"Region used when user didn't choose one" choice:"ru" choice:"eu" choice:"na" choice:"asia" default:"ru"`
+	VehiclesTTL       time.Duration `long:"vehicles-ttl" env:"VEHICLES_TTL" description:"How long local vehicle catalog is considered fresh" default:"24h"`
+	ClanRosterTTL     time.Duration `long:"clan-roster-ttl" env:"CLAN_ROSTER_TTL" description:"How long cached stats of clan members are considered fresh" default:"6h"`
+	ClanRosterTimeout time.Duration `long:"clan-roster-timeout" env:"CLAN_ROSTER_TIMEOUT" description:"How long clan roster stats are fetched, members not fetched in time are shown without fresh stats" default:"10s"`
+	RefreshCooldown   time.Duration `long:"refresh-cooldown" env:"REFRESH_COOLDOWN" description:"Minimal time between stats refreshes requested by user" default:"10m"`
+	NotifyMinChange   float64       `long:"notify-min-change" env:"NOTIFY_MIN_CHANGE" description:"Default change of stat in percent users are notified about" default:"5"`
+}
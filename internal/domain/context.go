@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestKey struct{}
+
+// Request describes the update which caused the work, it goes through context down to adapters logs
+type Request struct {
+	UpdateID   int
+	TelegramID int
+}
+
+func WithRequest(ctx context.Context, r *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// RequestFromContext returns nil if the work isn't caused by update, e.g. it's a scheduled job
+func RequestFromContext(ctx context.Context) *Request {
+	r, _ := ctx.Value(requestKey{}).(*Request)
+	return r
+}
+
+// Logger adds request fields from context to the logger
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	r := RequestFromContext(ctx)
+	if r == nil {
+		return logger
+	}
+
+	return logger.With(zap.Int("update_id", r.UpdateID), zap.Int("request_telegram_id", r.TelegramID))
+}
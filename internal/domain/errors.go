@@ -1,6 +1,9 @@
 package domain
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var (
 	// Error that could occur during database querying
@@ -11,14 +14,66 @@ var (
 	ErrInternalXVM = fmt.Errorf("internal XVM stats error")
 	// Error that could occur during KTTC stats call
 	ErrInternalKTTC = fmt.Errorf("internal KTTC stats error")
+	// Error that could occur during rating computation
+	ErrInternalRating = fmt.Errorf("internal rating error")
+	// Error that occurs if there are no expected values for any of passed tanks
+	ErrExpectedValuesNotFound = fmt.Errorf("expected values not found")
 	// Error that occurs if user passed wrong data on input
 	ErrBotBadRequest = fmt.Errorf("bot bad request")
+	// Error that occurs if user passed unsupported region
+	ErrUnknownRegion = fmt.Errorf("unknown region")
+	// Error that occurs if user passed unsupported language
+	ErrUnknownLanguage = fmt.Errorf("unknown language")
 	// Error that occurs if player not found
 	ErrPlayerNotFound = fmt.Errorf("player not found")
+	// Error that occurs if vehicle not found in catalog
+	ErrVehicleNotFound = fmt.Errorf("vehicle not found")
+	// Error that occurs if clan with such tag not found
+	ErrClanNotFound = fmt.Errorf("clan not found")
+	// Error that occurs if player has no battles on requested vehicle
+	ErrTankStatsNotFound = fmt.Errorf("tank stats not found")
 	// Error that occurs if user not found
 	ErrUserNotFound = fmt.Errorf("user not found")
 	// Error that occurs if user didn't save nickname
 	ErrNicknameNotSaved = fmt.Errorf("nickname not saved")
-	// Error that occurs if trend image not found
-	ErrTrendImageNotFound = fmt.Errorf("trend image not found")
+	// Error that occurs if user has no stats snapshot for requested time
+	ErrSnapshotNotFound = fmt.Errorf("snapshot not found")
+	// Error that occurs if user isn't subscribed to notifications
+	ErrSubscriptionNotFound = fmt.Errorf("subscription not found")
+	// Error that occurs if upstream response isn't cached or already expired
+	ErrCacheEntryNotFound = fmt.Errorf("cache entry not found")
+	// Error that occurs if user asks too often
+	ErrRateLimited = fmt.Errorf("rate limited")
+	// Error that occurs if source keeps failing and isn't called for a while
+	ErrSourceUnavailable = fmt.Errorf("source temporarily unavailable")
 )
+
+// RateLimitError tells how long user has to wait, it matches ErrRateLimited
+type RateLimitError struct {
+	Wait time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrRateLimited, e.Wait)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// UnavailableError is returned while source is down, it matches both ErrSourceUnavailable and error of the source
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrSourceUnavailable, e.Err)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrSourceUnavailable
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
@@ -1,269 +1,1861 @@
 package domain
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
+	"github.com/L11R/wotbot/internal/i18n"
 	"go.uber.org/zap"
 )
 
+const (
+	// Nickname suggestions count in inline mode, Telegram accepts up to 50 results
+	inlineSuggestionsLimit = 10
+	// Vehicles count listed when tank name is ambiguous
+	vehiclesSuggestionsLimit = 15
+	// KTTC stats window shown if user didn't ask for another one
+	kttcDefaultWindow = "1000"
+	// Players count in /compare, table doesn't fit phone screen with more columns
+	compareLimit = 4
+	// Best clan members count listed in /clan
+	clanTopLimit = 5
+	// Chat members count listed in /top
+	chatTopLimit = 20
+)
+
+// topMetrics are /top arguments, the first one is default
+var topMetrics = []struct {
+	names  []string
+	metric Metric
+	title  string
+}{
+	{names: []string{"wn8"}, metric: MetricWN8, title: "WN8"},
+	{names: []string{"winrate", "wr", "побед"}, metric: MetricWinrate, title: "проценту побед"},
+	{names: []string{"damage", "dmg", "урон"}, metric: MetricDamage, title: "среднему урону"},
+	{names: []string{"battles", "бои"}, metric: MetricBattles, title: "количеству боёв"},
+}
+
+var masteryBadges = map[int]string{
+	0: "нет",
+	1: "3 степень",
+	2: "2 степень",
+	3: "1 степень",
+	4: "Мастер",
+}
+
 type Service interface {
-	GetCreateUserMessage(telegramID int) (string, error)
-	GetSaveNicknameMessage(telegramID int, nickname string) (string, error)
-	GetRefreshMessage(telegramID int) (string, error)
-	GetMeMessage(telegramID int, chatType string) (string, error)
-	GetTrendImage(telegramID int, htmlID string) ([]byte, error)
-	GetStatsMessage(nickname string) (string, error)
-	GetKTTCStatsMessage(nickname string) (string, error)
+	GetCreateUserMessage(ctx context.Context, telegramID int) (*Result, error)
+	GetSaveNicknameMessage(ctx context.Context, telegramID int, query string) (*Result, error)
+	GetRefreshMessage(ctx context.Context, telegramID int) (*Result, error)
+	GetAutoRefreshMessage(ctx context.Context, telegramID int, state string) (*Result, error)
+	GetNotifyMessage(ctx context.Context, telegramID int, args string) (*Result, error)
+	GetSubscribedTelegramIDs(ctx context.Context) ([]int, error)
+	GetNotificationMessage(ctx context.Context, telegramID int) (*Result, *Subscription, error)
+	CommitNotification(ctx context.Context, sub *Subscription) error
+	GetMeMessage(ctx context.Context, telegramID int) (*Result, []*XVMStat, error)
+	GetDiffMessage(ctx context.Context, telegramID int, period time.Duration) (*Result, error)
+	GetStatsMessage(ctx context.Context, telegramID int, query string) (*Result, error)
+	GetKTTCStatsMessage(ctx context.Context, telegramID int, query string, window string, extended bool) (*Result, error)
+	GetInlineQueryResults(ctx context.Context, telegramID int, query string) ([]*InlineResult, error)
+	GetRegionMessage(ctx context.Context, telegramID int, region string) (*Result, error)
+	GetLanguage(ctx context.Context, telegramID int, languageCode string) (i18n.Lang, error)
+	GetLanguageMessage(ctx context.Context, telegramID int, lang string) (*Result, error)
+	GetWargamingStatsMessage(ctx context.Context, telegramID int, query string) (*Result, error)
+	GetCompareMessage(ctx context.Context, telegramID int, queries []string) (*Result, error)
+	GetClanMessage(ctx context.Context, telegramID int, query string) (*Result, error)
+	TrackChatMember(ctx context.Context, chatID int64, telegramID int) error
+	ForgetChatMember(ctx context.Context, chatID int64, telegramID int) error
+	GetTopMessage(ctx context.Context, chatID int64, metric string) (*Result, error)
+	GetTankStatsMessage(ctx context.Context, telegramID int, query string, vehicle string) (*Result, error)
+}
+
+// Refresher refreshes stats without user requests, it's used by scheduler and isn't a part of bot commands
+type Refresher interface {
+	GetAutoRefreshTelegramIDs(ctx context.Context) ([]int, error)
+	RefreshStats(ctx context.Context, telegramID int) error
 }
 
 type Wargaming interface {
-	FindPlayer(nickname string) (string, int, error)
+	FindPlayer(ctx context.Context, region Region, nickname string) (string, int, error)
+	SearchPlayers(ctx context.Context, region Region, nickname string, limit int) ([]*Player, error)
+	GetAccountInfo(ctx context.Context, region Region, accountID int) (*AccountInfo, error)
+	GetAccountsInfo(ctx context.Context, region Region, accountIDs []int) (map[int]*AccountInfo, error)
+	GetVehicles(ctx context.Context, region Region) ([]*Vehicle, error)
+	GetTankStats(ctx context.Context, region Region, accountID int, tankID int) (*TankStats, error)
+	GetTanksStats(ctx context.Context, region Region, accountID int) ([]*TankStats, error)
+	GetAccountsTanksStats(ctx context.Context, region Region, accountIDs []int) (map[int][]*TankStats, error)
+	FindClan(ctx context.Context, region Region, tag string) (int, error)
+	GetClanInfo(ctx context.Context, region Region, clanID int) (*Clan, error)
+}
+
+type Rating interface {
+	WN8(stats ...*TankStats) (float64, error)
+}
+
+type Scales interface {
+	Grade(region Region, metric Metric, value float64) *Grade
+	Metric(name string) (Metric, bool)
 }
 
 type XVM interface {
-	GetStats(accountID int, withTrend bool) ([]*XVMStat, error)
+	GetStats(ctx context.Context, region Region, accountID int, withTrend bool) ([]*XVMStat, error)
 }
 
 type KTTC interface {
-	GetStats(accountID int) ([]*KTTCStat, error)
+	GetStats(ctx context.Context, region Region, accountID int) ([]*KTTCWindow, error)
 }
 
 type Database interface {
-	GetUserByTelegramID(telegramID int) (*User, error)
-	UpsertUser(user *User) (*User, error)
-	GetStatsByUserID(userID int) ([]*XVMStat, error)
-	UpdateStatsByUserID(userID int, stats []*XVMStat) ([]*XVMStat, error)
+	GetUserByTelegramID(ctx context.Context, telegramID int) (*User, error)
+	GetAutoRefreshUsers(ctx context.Context) ([]*User, error)
+	UpsertChatMember(ctx context.Context, chatID int64, telegramID int) error
+	DeleteChatMember(ctx context.Context, chatID int64, telegramID int) error
+	GetChatUsers(ctx context.Context, chatID int64) ([]*User, error)
+	UpsertUser(ctx context.Context, user *User) (*User, error)
+	GetStatsByUserID(ctx context.Context, userID int) ([]*XVMStat, error)
+	GetLatestStatsByUserIDs(ctx context.Context, userIDs []int) ([]*XVMStat, error)
+	GetStatsBySnapshotID(ctx context.Context, snapshotID int) ([]*XVMStat, error)
+	CreateSnapshot(ctx context.Context, userID int, stats []*XVMStat) (*Snapshot, error)
+	GetSnapshotsByUserID(ctx context.Context, userID int) ([]*Snapshot, error)
+	GetSnapshotByTime(ctx context.Context, userID int, t time.Time) (*Snapshot, error)
+	GetVehicles(ctx context.Context, region Region) ([]*Vehicle, error)
+	ReplaceVehicles(ctx context.Context, region Region, vehicles []*Vehicle) error
+	GetClanMembers(ctx context.Context, region Region, clanID int) ([]*ClanMember, error)
+	ReplaceClanMembers(ctx context.Context, region Region, clanID int, members []*ClanMember) error
+	GetSubscriptions(ctx context.Context) ([]*Subscription, error)
+	GetSubscriptionByUserID(ctx context.Context, userID int) (*Subscription, error)
+	UpsertSubscription(ctx context.Context, subscription *Subscription) error
+	UpdateSubscriptionBaseline(ctx context.Context, subscription *Subscription) error
+	DeleteSubscription(ctx context.Context, userID int) error
+	GetCacheEntry(ctx context.Context, key string) ([]byte, error)
+	GetCacheEntries(ctx context.Context, keys []string) (map[string][]byte, error)
+	SetCacheEntry(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	DeleteExpiredCacheEntries(ctx context.Context) error
 }
 
 type service struct {
 	logger    *zap.Logger
+	config    *Config
 	database  Database
 	wargaming Wargaming
 	xvm       XVM
 	kttc      KTTC
+	rating    Rating
+	scales    Scales
 }
 
-func NewService(logger *zap.Logger, database Database, wargaming Wargaming, xvm XVM, kttc KTTC) Service {
+func NewService(logger *zap.Logger, config *Config, database Database, wargaming Wargaming, xvm XVM, kttc KTTC, rating Rating, scales Scales) Service {
 	s := &service{
 		logger:    logger,
+		config:    config,
 		database:  database,
 		wargaming: wargaming,
 		xvm:       xvm,
 		kttc:      kttc,
+		rating:    rating,
+		scales:    scales,
+	}
+
+	return s
+}
+
+// NewRefresher returns stats refresher, it needs only database and XVM
+func NewRefresher(logger *zap.Logger, config *Config, database Database, xvm XVM) Refresher {
+	s := &service{
+		logger:   logger,
+		config:   config,
+		database: database,
+		xvm:      xvm,
 	}
 
 	return s
 }
 
-func (s *service) GetCreateUserMessage(telegramID int) (string, error) {
-	user, err := s.database.UpsertUser(&User{
+func (s *service) GetCreateUserMessage(ctx context.Context, telegramID int) (*Result, error) {
+	user, err := s.database.UpsertUser(ctx, &User{
 		TelegramID: telegramID,
 	})
 	if err != nil {
-		s.logger.Error("Error upserting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error upserting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
 	}
 
-	msg := `Привет.
-
-Команды:
-/get <i>nickname</i> — запрашивает и отображает статистику игрока.
-/save <i>nickname</i> — позволяет сохранить свой никнейм.
-/me — выводит расширенную статистику по сохранённому никнейму.
-/refresh — обновляет кэш.`
+	result := &Result{
+		Text: s.t(ctx, "Привет."),
+		Sections: []*Section{{
+			Title: s.t(ctx, "Команды"),
+			Items: []string{
+				s.t(ctx, "/get nickname — запрашивает и отображает статистику игрока."),
+				s.t(ctx, "/kttc nickname [окно] [full] — статистика KTTC за последние 100, 500, 1000… боёв, full — все показатели."),
+				s.t(ctx, "/wg nickname — официальная статистика игрока из Wargaming API."),
+				s.t(ctx, "/clan TAG — информация о клане и статистика его состава."),
+				s.t(ctx, "/top [wn8|winrate|damage|battles] — рейтинг участников группы, сохранивших никнейм."),
+				s.t(ctx, "/compare nickname1 nickname2 … — сравнивает показатели нескольких игроков."),
+				s.t(ctx, "/tank nickname танк — статистика игрока на конкретной технике."),
+				s.t(ctx, "/save nickname — позволяет сохранить свой никнейм."),
+				s.t(ctx, "/region [ru|eu|na|asia] — показывает или меняет регион по умолчанию."),
+				s.t(ctx, "Регион можно указать и прямо в никнейме: /get eu:nickname."),
+				s.t(ctx, "/lang [ru|en] — показывает или меняет язык бота."),
+				s.t(ctx, "/me — выводит расширенную статистику по сохранённому никнейму."),
+				s.t(ctx, "/refresh — обновляет кэш."),
+				s.t(ctx, "/autorefresh [on|off] — включает или выключает автоматическое обновление статистики."),
+				s.t(ctx, "/notify [on [порог %]|off] — уведомления о смене цвета показателей или их заметном изменении."),
+				s.t(ctx, "/diff [период] — показывает изменения показателей, например за 7d или 2w."),
+			},
+		}},
+	}
 
 	if user.Nickname != nil {
-		msg += fmt.Sprintf("\n\nКстати, ты уже сохранил свой никнейм, приветствую <b>%s</b>!", *user.Nickname)
+		result.Footer = s.t(ctx, "Кстати, ты уже сохранил свой никнейм, приветствую %s!", *user.Nickname)
 	}
 
-	return msg, nil
+	return result, nil
 }
 
-func (s *service) GetSaveNicknameMessage(telegramID int, nickname string) (string, error) {
-	nickname, accountID, err := s.wargaming.FindPlayer(nickname)
+func (s *service) GetSaveNicknameMessage(ctx context.Context, telegramID int, query string) (*Result, error) {
+	region, nickname, err := s.resolvePlayerQuery(ctx, telegramID, query)
 	if err != nil {
-		s.logger.Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
-		return "", err
+		return nil, err
 	}
 
-	if _, err = s.database.UpsertUser(&User{
-		TelegramID:  telegramID,
-		Nickname:    &nickname,
-		WargamingID: &accountID,
+	nickname, accountID, err := s.wargaming.FindPlayer(ctx, region, nickname)
+	if err != nil {
+		s.log(ctx).Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
+		return nil, err
+	}
+
+	if _, err = s.database.UpsertUser(ctx, &User{
+		TelegramID:      telegramID,
+		Nickname:        &nickname,
+		WargamingID:     &accountID,
+		WargamingRegion: &region,
 	}); err != nil {
-		s.logger.Error(
+		s.log(ctx).Error(
 			"Error upserting user!",
 			zap.Int("telegram_id", telegramID),
 			zap.String("nickname", nickname),
 			zap.Int("wargaming_id", accountID),
 			zap.Error(err),
 		)
-		return "", err
+		return nil, err
 	}
 
-	stats, err := s.xvm.GetStats(accountID, true)
+	stats, err := s.xvm.GetStats(ctx, region, accountID, true)
 	if err != nil {
-		s.logger.Error("Error getting XVM stats!", zap.Int("wargaming_id", accountID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting XVM stats!", zap.Int("wargaming_id", accountID), zap.Error(err))
+		return nil, err
 	}
 
-	user, err := s.database.GetUserByTelegramID(telegramID)
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
-		s.logger.Error("Error getting user by telegram_id!", zap.Int("telegram_id", telegramID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting user by telegram_id!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
 	}
 
-	if _, err = s.database.UpdateStatsByUserID(user.ID, stats); err != nil {
-		s.logger.Error("Error updating stats by user_id!", zap.Int("user_id", telegramID), zap.Error(err))
-		return "", err
+	if _, err = s.database.CreateSnapshot(ctx, user.ID, stats); err != nil {
+		s.log(ctx).Error("Error creating stats snapshot!", zap.Int("user_id", user.ID), zap.Error(err))
+		return nil, err
+	}
+
+	// Stats are just fetched, so there is no point in /refresh right after /save
+	if err := s.markRefreshed(ctx, telegramID); err != nil {
+		return nil, err
 	}
 
-	return "Твой никнейм сохранён, ты можешь посмотреть свою статистику здесь: /me", nil
+	return NewTextResult(s.t(ctx, "Твой никнейм сохранён, ты можешь посмотреть свою статистику здесь: /me")), nil
 }
 
-func (s *service) GetRefreshMessage(telegramID int) (string, error) {
-	user, err := s.database.GetUserByTelegramID(telegramID)
+func (s *service) GetRefreshMessage(ctx context.Context, telegramID int) (*Result, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
-		s.logger.Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	// Cooldown is counted from stored time, so restart doesn't reset it
+	if user.RefreshedAt != nil {
+		if wait := s.config.RefreshCooldown - time.Since(*user.RefreshedAt); wait > 0 {
+			return nil, &RateLimitError{Wait: wait}
+		}
+	}
+
+	if err := s.refreshStats(ctx, user); err != nil {
+		return nil, err
 	}
 
+	if err := s.markRefreshed(ctx, telegramID); err != nil {
+		return nil, err
+	}
+
+	return NewTextResult(s.t(ctx, "Статистика обновлена!")), nil
+}
+
+// RefreshStats fetches fresh XVM stats and saves them as a new snapshot, it's used by scheduler,
+// which doesn't touch cooldown of manual refresh
+func (s *service) RefreshStats(ctx context.Context, telegramID int) error {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return err
+	}
+
+	return s.refreshStats(ctx, user)
+}
+
+// markRefreshed starts cooldown of manual refresh
+func (s *service) markRefreshed(ctx context.Context, telegramID int) error {
+	// Column has no time zone, so UTC is stored to be read back the same way
+	now := time.Now().UTC()
+	if _, err := s.database.UpsertUser(ctx, &User{
+		TelegramID:  telegramID,
+		RefreshedAt: &now,
+	}); err != nil {
+		s.log(ctx).Error("Error upserting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *service) refreshStats(ctx context.Context, user *User) error {
 	if user.WargamingID == nil {
-		s.logger.Error("User Wargaming ID is null, he didn't save nickname!")
-		return "", ErrNicknameNotSaved
+		s.log(ctx).Error("User Wargaming ID is null, he didn't save nickname!")
+		return ErrNicknameNotSaved
 	}
 
-	stats, err := s.xvm.GetStats(*user.WargamingID, true)
+	stats, err := s.xvm.GetStats(ctx, s.accountRegion(user), *user.WargamingID, true)
 	if err != nil {
-		s.logger.Error("Error getting XVM stats!", zap.Int("wargaming_id", *user.WargamingID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting XVM stats!", zap.Int("wargaming_id", *user.WargamingID), zap.Error(err))
+		return err
 	}
 
-	if _, err = s.database.UpdateStatsByUserID(user.ID, stats); err != nil {
-		s.logger.Error("Error updating stats by user_id!", zap.Int("user_id", telegramID), zap.Error(err))
-		return "", err
+	if _, err = s.database.CreateSnapshot(ctx, user.ID, stats); err != nil {
+		s.log(ctx).Error("Error creating stats snapshot!", zap.Int("user_id", user.ID), zap.Error(err))
+		return err
 	}
 
-	return "Статистика обновлена!", nil
+	return nil
 }
 
-func (s *service) GetMeMessage(telegramID int, chatType string) (string, error) {
-	user, err := s.database.GetUserByTelegramID(telegramID)
+func (s *service) GetAutoRefreshMessage(ctx context.Context, telegramID int, state string) (*Result, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
-		s.logger.Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	var enabled bool
+	switch strings.ToLower(strings.TrimSpace(state)) {
+	case "":
+		if user.AutoRefresh != nil && *user.AutoRefresh {
+			return NewTextResult(s.t(ctx, "Автообновление статистики включено.")), nil
+		}
+		return NewTextResult(s.t(ctx, "Автообновление статистики выключено.")), nil
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return nil, ErrBotBadRequest
+	}
+
+	// There is nothing to refresh without saved nickname
+	if enabled && user.WargamingID == nil {
+		return nil, ErrNicknameNotSaved
+	}
+
+	if _, err := s.database.UpsertUser(ctx, &User{
+		TelegramID:  telegramID,
+		AutoRefresh: &enabled,
+	}); err != nil {
+		s.log(ctx).Error("Error upserting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	if enabled {
+		return NewTextResult(s.t(ctx, "Автообновление статистики включено, /me будет обновляться без /refresh.")), nil
 	}
 
-	ss, err := s.database.GetStatsByUserID(user.ID)
+	return NewTextResult(s.t(ctx, "Автообновление статистики выключено.")), nil
+}
+
+func (s *service) GetAutoRefreshTelegramIDs(ctx context.Context) ([]int, error) {
+	users, err := s.database.GetAutoRefreshUsers(ctx)
 	if err != nil {
-		s.logger.Error("Error getting stats by user_id!", zap.Int("user_id", telegramID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting auto refresh users!", zap.Error(err))
+		return nil, err
 	}
 
-	if user.Nickname == nil || user.WargamingID == nil {
-		s.logger.Error("User nickname or Wargaming ID are null, he didn't save nickname!")
-		return "", ErrNicknameNotSaved
+	ids := make([]int, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.TelegramID)
+	}
+
+	return ids, nil
+}
+
+func (s *service) GetNotifyMessage(ctx context.Context, telegramID int, args string) (*Result, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	fields := strings.Fields(strings.ToLower(args))
+	if len(fields) == 0 {
+		sub, err := s.database.GetSubscriptionByUserID(ctx, user.ID)
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			return NewTextResult(s.t(ctx, "Уведомления выключены.")), nil
+		}
+		if err != nil {
+			s.log(ctx).Error("Error getting subscription!", zap.Int("user_id", user.ID), zap.Error(err))
+			return nil, err
+		}
+
+		return NewTextResult(s.t(ctx, "Уведомления включены, порог изменения: %g%%.", sub.MinChange)), nil
+	}
+
+	switch fields[0] {
+	case "on":
+	case "off":
+		if err := s.database.DeleteSubscription(ctx, user.ID); err != nil {
+			s.log(ctx).Error("Error deleting subscription!", zap.Int("user_id", user.ID), zap.Error(err))
+			return nil, err
+		}
+
+		return NewTextResult(s.t(ctx, "Уведомления выключены.")), nil
+	default:
+		return nil, ErrBotBadRequest
+	}
+
+	if user.WargamingID == nil {
+		return nil, ErrNicknameNotSaved
+	}
+
+	minChange := s.config.NotifyMinChange
+	if len(fields) > 1 {
+		minChange, err = strconv.ParseFloat(strings.TrimSuffix(strings.Replace(fields[1], ",", ".", 1), "%"), 64)
+		if err != nil || minChange <= 0 {
+			return nil, ErrBotBadRequest
+		}
+	}
+
+	// Latest snapshot becomes a baseline, KTTC baseline is taken on the first check
+	sub := &Subscription{
+		UserID:    user.ID,
+		MinChange: minChange,
+	}
+	snapshots, err := s.database.GetSnapshotsByUserID(ctx, user.ID)
+	if err != nil {
+		s.log(ctx).Error("Error getting snapshots!", zap.Int("user_id", user.ID), zap.Error(err))
+		return nil, err
+	}
+	if len(snapshots) != 0 {
+		sub.SnapshotID = &snapshots[0].ID
+	}
+
+	if err := s.database.UpsertSubscription(ctx, sub); err != nil {
+		s.log(ctx).Error("Error upserting subscription!", zap.Int("user_id", user.ID), zap.Error(err))
+		return nil, err
+	}
+
+	return NewTextResult(s.t(ctx,
+		"Уведомления включены: пришлю сообщение, если показатель сменит цвет или изменится больше чем на %g%%.",
+		minChange,
+	)), nil
+}
+
+func (s *service) GetSubscribedTelegramIDs(ctx context.Context) ([]int, error) {
+	subs, err := s.database.GetSubscriptions(ctx)
+	if err != nil {
+		s.log(ctx).Error("Error getting subscriptions!", zap.Error(err))
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(subs))
+	for _, sub := range subs {
+		ids = append(ids, sub.TelegramID)
+	}
+
+	return ids, nil
+}
+
+// GetNotificationMessage compares current stats with ones user was notified about, empty message means nothing changed.
+// Returned subscription holds the new baseline, it's saved by CommitNotification once the message is delivered.
+func (s *service) GetNotificationMessage(ctx context.Context, telegramID int) (*Result, *Subscription, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, nil, err
 	}
 
-	msg := fmt.Sprintf("<b>Игрок:</b> %s <a href=\"https://stats.modxvm.com/ru/stat/players/%d\">(на сайте XVM)</a>\n\n", *user.Nickname, *user.WargamingID)
-	for _, s := range ss {
-		if s.Value != nil {
-			if chatType == "private" {
-				msg += fmt.Sprintf("<b>%s:</b> %s %s\n", s.Name, *s.Value, strings.Replace(s.HtmlID, "#", "/", 1))
-			} else {
-				msg += fmt.Sprintf("<b>%s:</b> %s\n", s.Name, *s.Value)
+	sub, err := s.database.GetSubscriptionByUserID(ctx, user.ID)
+	if err != nil {
+		s.log(ctx).Error("Error getting subscription!", zap.Int("user_id", user.ID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	if user.WargamingID == nil {
+		return nil, nil, ErrNicknameNotSaved
+	}
+
+	region := s.accountRegion(user)
+	var xvmLines, kttcLines []*Stat
+
+	// XVM values come from snapshots made by /refresh and scheduler, so XVM isn't requested here
+	snapshots, err := s.database.GetSnapshotsByUserID(ctx, user.ID)
+	if err != nil {
+		s.log(ctx).Error("Error getting snapshots!", zap.Int("user_id", user.ID), zap.Error(err))
+		return nil, nil, err
+	}
+	if len(snapshots) != 0 && (sub.SnapshotID == nil || *sub.SnapshotID != snapshots[0].ID) {
+		if sub.SnapshotID != nil {
+			prev, err := s.database.GetStatsBySnapshotID(ctx, *sub.SnapshotID)
+			if err != nil {
+				s.log(ctx).Error("Error getting stats by snapshot_id!", zap.Int("snapshot_id", *sub.SnapshotID), zap.Error(err))
+				return nil, nil, err
+			}
+
+			cur, err := s.database.GetStatsByUserID(ctx, user.ID)
+			if err != nil {
+				s.log(ctx).Error("Error getting stats by user_id!", zap.Int("user_id", user.ID), zap.Error(err))
+				return nil, nil, err
+			}
+
+			prevValues := make(StatValues)
+			for _, stat := range s.trackedXVMStats(prev) {
+				prevValues[stat.name] = stat.value
 			}
+			xvmLines = s.evaluateRules(ctx, region, sub.MinChange, prevValues, s.trackedXVMStats(cur))
+		}
+
+		sub.SnapshotID = &snapshots[0].ID
+	}
+
+	// KTTC has no history of its own, so the last seen values are kept in subscription
+	ww, err := s.kttc.GetStats(ctx, region, *user.WargamingID)
+	if err != nil {
+		s.log(ctx).Warn("Error getting KTTC stats!", zap.Int("wargaming_id", *user.WargamingID), zap.Error(err))
+	}
+	for _, w := range ww {
+		if w.Key != kttcDefaultWindow {
+			continue
+		}
+
+		cur := make([]*trackedStat, 0, len(w.Stats))
+		values := make(StatValues, len(w.Stats))
+		for _, stat := range w.Stats {
+			cur = append(cur, &trackedStat{name: stat.Name, metric: stat.Metric, value: stat.Value, precision: stat.Precision})
+			values[stat.Name] = stat.Value
+		}
+
+		if sub.KTTCValues != nil {
+			kttcLines = s.evaluateRules(ctx, region, sub.MinChange, sub.KTTCValues, cur)
+		}
+		sub.KTTCValues = values
+	}
+
+	if len(xvmLines) == 0 && len(kttcLines) == 0 {
+		return nil, sub, nil
+	}
+
+	result := &Result{
+		Header: &Header{Label: s.t(ctx, "Игрок"), Name: *user.Nickname},
+		Text:   s.t(ctx, "Статистика изменилась!"),
+	}
+	if len(xvmLines) != 0 {
+		result.Sections = append(result.Sections, &Section{Title: "XVM", Stats: xvmLines})
+	}
+	if len(kttcLines) != 0 {
+		result.Sections = append(result.Sections, &Section{Title: "KTTC " + s.kttcWindowTitle(ctx, kttcDefaultWindow), Stats: kttcLines})
+	}
+
+	return result, sub, nil
+}
+
+// CommitNotification saves values user was notified about, so the same changes aren't reported again
+func (s *service) CommitNotification(ctx context.Context, sub *Subscription) error {
+	if err := s.database.UpdateSubscriptionBaseline(ctx, sub); err != nil {
+		s.log(ctx).Error("Error updating subscription baseline!", zap.Int("user_id", sub.UserID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// trackedStat is a stat value notification rules are evaluated over
+type trackedStat struct {
+	name      string
+	metric    Metric
+	value     float64
+	precision int
+}
+
+func (s *service) trackedXVMStats(ss []*XVMStat) []*trackedStat {
+	tracked := make([]*trackedStat, 0, len(ss))
+	for _, stat := range ss {
+		value, precision, ok := stat.Number()
+		if !ok {
+			continue
 		}
+
+		metric, _ := s.scales.Metric(stat.Name)
+		tracked = append(tracked, &trackedStat{name: stat.Name, metric: metric, value: value, precision: precision})
 	}
 
-	if chatType == "private" {
-		msg += "\n<b>Техника:</b>\n"
-		for _, s := range ss {
-			if s.Value == nil {
-				msg += fmt.Sprintf("<b>%s:</b> %s\n", s.Name, strings.Replace(s.HtmlID, "#", "/", 1))
+	return tracked
+}
+
+// evaluateRules describes changes of consecutive values: rating grade change or relative change of at least minChange percent
+func (s *service) evaluateRules(ctx context.Context, region Region, minChange float64, prev StatValues, cur []*trackedStat) []*Stat {
+	var lines []*Stat
+	for _, stat := range cur {
+		old, ok := prev[stat.name]
+		if !ok || old == stat.value {
+			continue
+		}
+
+		// Grade is reported only when it's changed
+		var grade *Grade
+		if stat.metric != "" {
+			og, ng := s.scales.Grade(region, stat.metric, old), s.scales.Grade(region, stat.metric, stat.value)
+			if og != nil && ng != nil && *og != *ng {
+				grade = s.grade(ctx, region, stat.metric, stat.value)
 			}
 		}
+
+		var relative float64
+		if old != 0 {
+			relative = (stat.value - old) / math.Abs(old) * 100
+		}
+
+		if grade == nil && (old == 0 || math.Abs(relative) < minChange) {
+			continue
+		}
+
+		line := &Stat{
+			Name:     s.t(ctx, stat.name),
+			Value:    fmt.Sprintf("%.*f", stat.precision, stat.value),
+			Previous: fmt.Sprintf("%.*f", stat.precision, old),
+			Grade:    grade,
+		}
+		if old != 0 {
+			line.Delta = &Delta{Value: relative, Precision: 2, Percent: true}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (s *service) GetMeMessage(ctx context.Context, telegramID int) (*Result, []*XVMStat, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	ss, err := s.database.GetStatsByUserID(ctx, user.ID)
+	if err != nil {
+		s.log(ctx).Error("Error getting stats by user_id!", zap.Int("user_id", telegramID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	if user.Nickname == nil || user.WargamingID == nil {
+		s.log(ctx).Error("User nickname or Wargaming ID are null, he didn't save nickname!")
+		return nil, nil, ErrNicknameNotSaved
+	}
+
+	region := s.accountRegion(user)
+	section := &Section{}
+	charts := make([]*XVMStat, 0, len(ss))
+	for _, stat := range ss {
+		if stat.Value != nil {
+			section.Stats = append(section.Stats, s.xvmStat(ctx, region, stat))
+		}
+		if len(stat.Image) != 0 {
+			charts = append(charts, stat)
+		}
 	}
 
-	return msg, nil
+	return &Result{
+		Header:   s.xvmHeader(ctx, region, *user.Nickname, *user.WargamingID),
+		Sections: []*Section{section},
+	}, charts, nil
 }
 
-func (s *service) GetTrendImage(telegramID int, htmlID string) ([]byte, error) {
-	user, err := s.database.GetUserByTelegramID(telegramID)
+func (s *service) GetDiffMessage(ctx context.Context, telegramID int, period time.Duration) (*Result, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	if user.Nickname == nil || user.WargamingID == nil {
+		s.log(ctx).Error("User nickname or Wargaming ID are null, he didn't save nickname!")
+		return nil, ErrNicknameNotSaved
+	}
+
+	snapshots, err := s.database.GetSnapshotsByUserID(ctx, user.ID)
+	if err != nil {
+		s.log(ctx).Error("Error getting snapshots by user_id!", zap.Int("user_id", user.ID), zap.Error(err))
+		return nil, err
+	}
+
+	if len(snapshots) == 0 {
+		return nil, ErrSnapshotNotFound
+	}
+
+	previous, err := s.database.GetSnapshotByTime(ctx, user.ID, time.Now().Add(-period))
 	if err != nil {
-		s.logger.Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		s.log(ctx).Error("Error getting snapshot by time!", zap.Int("user_id", user.ID), zap.Error(err))
 		return nil, err
 	}
 
-	ss, err := s.database.GetStatsByUserID(user.ID)
+	// Nothing to compare with
+	if previous.ID == snapshots[0].ID {
+		return nil, ErrSnapshotNotFound
+	}
+
+	ss, err := s.database.GetStatsByUserID(ctx, user.ID)
 	if err != nil {
-		s.logger.Error("Error getting stats by user_id!", zap.Int("user_id", telegramID), zap.Error(err))
+		s.log(ctx).Error("Error getting stats by user_id!", zap.Int("user_id", user.ID), zap.Error(err))
 		return nil, err
 	}
 
-	for i := range ss {
-		if ss[i].HtmlID == htmlID {
-			return ss[i].Image, nil
+	old := make(map[string]*XVMStat, len(previous.Stats))
+	for _, stat := range previous.Stats {
+		old[stat.HtmlID] = stat
+	}
+
+	section := &Section{
+		Title: s.t(ctx,
+			"Изменения с %s по %s",
+			previous.CreatedAt.Format("02.01.2006"),
+			snapshots[0].CreatedAt.Format("02.01.2006"),
+		),
+	}
+	for _, stat := range ss {
+		current, precision, ok := stat.Number()
+		if !ok {
+			continue
+		}
+
+		prev, ok := old[stat.HtmlID]
+		if !ok {
+			continue
 		}
+
+		before, _, ok := prev.Number()
+		if !ok {
+			continue
+		}
+
+		section.Stats = append(section.Stats, &Stat{
+			Name:  s.t(ctx, stat.Name),
+			Value: *stat.Value,
+			Delta: &Delta{Value: current - before, Precision: precision},
+		})
 	}
 
-	return nil, ErrTrendImageNotFound
+	return &Result{
+		Header:   &Header{Label: s.t(ctx, "Игрок"), Name: *user.Nickname},
+		Sections: []*Section{section},
+	}, nil
 }
 
-func (s *service) GetStatsMessage(nickname string) (string, error) {
-	nickname, accountID, err := s.wargaming.FindPlayer(nickname)
+func (s *service) GetStatsMessage(ctx context.Context, telegramID int, query string) (*Result, error) {
+	region, nickname, err := s.resolvePlayerQuery(ctx, telegramID, query)
 	if err != nil {
-		s.logger.Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
-		return "", err
+		return nil, err
 	}
 
-	ss, err := s.xvm.GetStats(accountID, false)
+	nickname, accountID, err := s.wargaming.FindPlayer(ctx, region, nickname)
 	if err != nil {
-		s.logger.Error("Error getting stats!", zap.Int("account_id", accountID), zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
+		return nil, err
+	}
+
+	return s.statsMessage(ctx, region, nickname, accountID)
+}
+
+func (s *service) statsMessage(ctx context.Context, region Region, nickname string, accountID int) (*Result, error) {
+	ss, err := s.xvm.GetStats(ctx, region, accountID, false)
+	if err != nil {
+		s.log(ctx).Error("Error getting stats!", zap.Int("account_id", accountID), zap.Error(err))
+		return nil, err
 	}
 
-	msg := fmt.Sprintf("<b>Игрок:</b> %s <a href=\"https://stats.modxvm.com/ru/stat/players/%d\">(на сайте XVM)</a>\n\n", nickname, accountID)
-	for _, s := range ss {
-		if s.Value != nil {
-			msg += fmt.Sprintf("<b>%s:</b> %s\n", s.Name, *s.Value)
+	result := &Result{Header: s.xvmHeader(ctx, region, nickname, accountID)}
+	section := &Section{}
+	for _, stat := range ss {
+		if stat.Value != nil {
+			section.Stats = append(section.Stats, s.xvmStat(ctx, region, stat))
 		}
 	}
 
-	if len(ss) == 0 {
-		msg += fmt.Sprintf("Показатели на найдены.")
+	if len(section.Stats) == 0 {
+		result.Text = s.t(ctx, "Показатели не найдены.")
+	} else {
+		result.Sections = []*Section{section}
 	}
 
-	return msg, nil
+	return result, nil
 }
 
-func (s *service) GetKTTCStatsMessage(nickname string) (string, error) {
-	nickname, accountID, err := s.wargaming.FindPlayer(nickname)
+func (s *service) GetKTTCStatsMessage(ctx context.Context, telegramID int, query string, window string, extended bool) (*Result, error) {
+	region, nickname, err := s.resolvePlayerQuery(ctx, telegramID, query)
 	if err != nil {
-		s.logger.Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
-		return "", err
+		return nil, err
 	}
 
-	ss, err := s.kttc.GetStats(accountID)
+	nickname, accountID, err := s.wargaming.FindPlayer(ctx, region, nickname)
 	if err != nil {
-		s.logger.Error("Error getting stats!", zap.Error(err))
-		return "", err
+		s.log(ctx).Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
+		return nil, err
 	}
 
-	msg := fmt.Sprintf("<b>Игрок:</b> %[1]s <a href=\"https://kttc.ru/wot/ru/user/%[1]s/\">(на сайте KTTC)</a>\n\n", nickname)
-	msg += "<b>Статистика за последнюю тысячу боёв:</b>\n"
-	for _, s := range ss {
-		if s.Delta != nil {
-			if *s.Delta > 0 {
-				msg += fmt.Sprintf("<b>%s:</b> %s %0.2f (+%0.2f)\n", s.Name, s.Color, s.Value, *s.Delta)
-			} else {
-				msg += fmt.Sprintf("<b>%s:</b> %s %0.2f (%0.2f)\n", s.Name, s.Color, s.Value, *s.Delta)
-			}
-		} else {
-			msg += fmt.Sprintf("<b>%s:</b> %s %0.2f\n", s.Name, s.Color, s.Value)
+	return s.kttcStatsMessage(ctx, region, nickname, accountID, window, extended)
+}
+
+func (s *service) kttcStatsMessage(ctx context.Context, region Region, nickname string, accountID int, window string, extended bool) (*Result, error) {
+	ww, err := s.kttc.GetStats(ctx, region, accountID)
+	if err != nil {
+		s.log(ctx).Error("Error getting stats!", zap.Error(err))
+		return nil, err
+	}
+
+	if window == "" {
+		window = kttcDefaultWindow
+	}
+
+	var w *KTTCWindow
+	keys := make([]string, 0, len(ww))
+	for _, candidate := range ww {
+		if strings.EqualFold(candidate.Key, window) {
+			w = candidate
+		}
+		keys = append(keys, candidate.Key)
+	}
+
+	// Unknown window isn't an error, user just gets the list of available ones
+	if w == nil {
+		return NewTextResult(s.t(ctx, "Статистика за %s не найдена, доступны: %s.", window, strings.Join(keys, ", "))), nil
+	}
+
+	section := &Section{Title: s.t(ctx, "Статистика %s", s.kttcWindowTitle(ctx, w.Key))}
+	for _, stat := range w.Stats {
+		if stat.Extended && !extended {
+			continue
 		}
+
+		result := &Stat{
+			Name:  s.t(ctx, stat.Name),
+			Value: fmt.Sprintf("%0.*f", stat.Precision, stat.Value),
+			Grade: s.grade(ctx, region, stat.Metric, stat.Value),
+		}
+		if stat.Delta != nil {
+			result.Delta = &Delta{Value: *stat.Delta, Precision: 2}
+		}
+
+		section.Stats = append(section.Stats, result)
+	}
+
+	result := &Result{
+		Header: &Header{
+			Label: s.t(ctx, "Игрок"),
+			Name:  nickname,
+			Link:  &Link{Text: s.t(ctx, "на сайте KTTC"), URL: KTTCPlayerURL(region, nickname)},
+		},
+		Sections: []*Section{section},
+	}
+	if w.Date != "" {
+		result.Footer = s.t(ctx, "Данные на %s", w.Date)
+	}
+
+	return result, nil
+}
+
+// kttcWindowTitle describes stats window, numeric windows are battle counts
+func (s *service) kttcWindowTitle(ctx context.Context, key string) string {
+	if _, err := strconv.Atoi(key); err == nil {
+		return s.t(ctx, "за последние %s боёв", key)
+	}
+
+	return s.t(ctx, "за всё время")
+}
+
+// comparedPlayer holds stats of a single /compare participant
+type comparedPlayer struct {
+	nickname string
+	kttc     []*KTTCStat
+	xvm      []*XVMStat
+}
+
+// compareRow is a metric line of /compare table, values are in players order
+type compareRow struct {
+	// Rows are matched by key, so the same metric shown under different names for different players isn't split
+	key    string
+	title  string
+	texts  []string
+	values []float64
+	known  []bool
+}
+
+func (s *service) GetCompareMessage(ctx context.Context, telegramID int, queries []string) (*Result, error) {
+	if len(queries) < 2 || len(queries) > compareLimit {
+		return nil, ErrBotBadRequest
+	}
+
+	var (
+		wg      sync.WaitGroup
+		players = make([]*comparedPlayer, len(queries))
+		errs    = make([]error, len(queries))
+	)
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			players[i], errs[i] = s.comparedPlayer(ctx, telegramID, queries[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var kttcRows, xvmRows []*compareRow
+	for i, p := range players {
+		for _, stat := range p.kttc {
+			if stat.Extended {
+				continue
+			}
+			row := findCompareRow(&kttcRows, stat.Name, s.t(ctx, stat.Name), len(players))
+			row.texts[i] = fmt.Sprintf("%0.*f", stat.Precision, stat.Value)
+			row.values[i], row.known[i] = stat.Value, true
+		}
+		for _, stat := range p.xvm {
+			if stat.Value == nil {
+				continue
+			}
+			// XVM labels depend on the player page locale, known metrics are matched regardless of it
+			key := stat.Name
+			if metric, ok := s.scales.Metric(stat.Name); ok {
+				key = string(metric)
+			}
+			row := findCompareRow(&xvmRows, key, s.t(ctx, stat.Name), len(players))
+			row.texts[i] = *stat.Value
+			row.values[i], _, row.known[i] = stat.Number()
+		}
+	}
+
+	columns := make([]string, 0, len(players))
+	for _, p := range players {
+		columns = append(columns, p.nickname)
+	}
+
+	result := &Result{Text: s.t(ctx, "Сравнение игроков")}
+	if len(kttcRows) != 0 {
+		result.Sections = append(result.Sections, &Section{
+			Title: "KTTC " + s.kttcWindowTitle(ctx, kttcDefaultWindow),
+			Table: compareTable(columns, kttcRows),
+		})
+	}
+	if len(xvmRows) != 0 {
+		result.Sections = append(result.Sections, &Section{
+			Title: "XVM",
+			Table: compareTable(columns, xvmRows),
+		})
+	}
+
+	return result, nil
+}
+
+// comparedPlayer fetches stats from both sources concurrently, one of them is enough for comparison
+func (s *service) comparedPlayer(ctx context.Context, telegramID int, query string) (*comparedPlayer, error) {
+	region, nickname, err := s.resolvePlayerQuery(ctx, telegramID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	nickname, accountID, err := s.wargaming.FindPlayer(ctx, region, nickname)
+	if err != nil {
+		s.log(ctx).Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
+		return nil, err
+	}
+
+	var (
+		wg              sync.WaitGroup
+		ww              []*KTTCWindow
+		xvmErr, kttcErr error
+	)
+	p := &comparedPlayer{nickname: nickname}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.xvm, xvmErr = s.xvm.GetStats(ctx, region, accountID, false)
+	}()
+	go func() {
+		defer wg.Done()
+		ww, kttcErr = s.kttc.GetStats(ctx, region, accountID)
+	}()
+	wg.Wait()
+
+	if xvmErr != nil {
+		s.log(ctx).Error("Error getting XVM stats!", zap.Int("account_id", accountID), zap.Error(xvmErr))
+	}
+	if kttcErr != nil {
+		s.log(ctx).Error("Error getting KTTC stats!", zap.Int("account_id", accountID), zap.Error(kttcErr))
+	}
+	if xvmErr != nil && kttcErr != nil {
+		return nil, kttcErr
+	}
+
+	for _, w := range ww {
+		if w.Key == kttcDefaultWindow {
+			p.kttc = w.Stats
+		}
+	}
+
+	return p, nil
+}
+
+func findCompareRow(rows *[]*compareRow, key, title string, players int) *compareRow {
+	for _, row := range *rows {
+		if row.key == key {
+			return row
+		}
+	}
+
+	row := &compareRow{
+		key:    key,
+		title:  title,
+		texts:  make([]string, players),
+		values: make([]float64, players),
+		known:  make([]bool, players),
+	}
+	*rows = append(*rows, row)
+
+	return row
+}
+
+// compareTable marks the best values of every row, the higher value is the better
+func compareTable(columns []string, rows []*compareRow) *Table {
+	table := &Table{Columns: columns}
+	for _, row := range rows {
+		best, compared := 0.0, 0
+		for i, ok := range row.known {
+			if ok && (compared == 0 || row.values[i] > best) {
+				best = row.values[i]
+			}
+			if ok {
+				compared++
+			}
+		}
+
+		tr := &TableRow{Title: row.title}
+		for i, text := range row.texts {
+			tr.Cells = append(tr.Cells, &TableCell{
+				Text: text,
+				Best: compared > 1 && row.known[i] && row.values[i] == best,
+			})
+		}
+		table.Rows = append(table.Rows, tr)
+	}
+
+	return table
+}
+
+func (s *service) GetClanMessage(ctx context.Context, telegramID int, query string) (*Result, error) {
+	region, tag, err := s.resolvePlayerQuery(ctx, telegramID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	clanID, err := s.wargaming.FindClan(ctx, region, tag)
+	if err != nil {
+		s.log(ctx).Error("Error finding clan!", zap.String("tag", tag), zap.Error(err))
+		return nil, err
+	}
+
+	clan, err := s.wargaming.GetClanInfo(ctx, region, clanID)
+	if err != nil {
+		s.log(ctx).Error("Error getting clan info!", zap.Int("clan_id", clanID), zap.Error(err))
+		return nil, err
+	}
+
+	members, err := s.clanRoster(ctx, region, clan)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Section{
+		Stats: []*Stat{
+			{Name: s.t(ctx, "Участники"), Value: strconv.Itoa(clan.MembersCount)},
+			{Name: s.t(ctx, "Командир"), Value: clan.LeaderName},
+		},
+	}
+	if !clan.CreatedAt.IsZero() && clan.CreatedAt.Unix() != 0 {
+		info.Stats = append(info.Stats, &Stat{Name: s.t(ctx, "Создан"), Value: clan.CreatedAt.UTC().Format("02.01.2006")})
+	}
+
+	result := &Result{
+		Header: &Header{
+			Label: s.t(ctx, "Клан"),
+			Name:  fmt.Sprintf("[%s] %s", clan.Tag, clan.Name),
+			Link:  &Link{Text: s.t(ctx, "на сайте Wargaming"), URL: WargamingClanURL(region, clan.ClanID)},
+		},
+		Sections: []*Section{info},
+	}
+
+	var (
+		rated              []*ClanMember
+		wn8Sum, winrateSum float64
+		winrates           int
+	)
+	for _, m := range members {
+		if m.WN8 != nil {
+			rated = append(rated, m)
+			wn8Sum += *m.WN8
+		}
+		if m.Winrate != nil {
+			winrateSum += *m.Winrate
+			winrates++
+		}
+	}
+
+	roster := &Section{Title: s.t(ctx, "Состав, Wargaming за всё время")}
+	result.Sections = append(result.Sections, roster)
+	if len(rated) == 0 {
+		roster.Items = []string{s.t(ctx, "Статистика участников не найдена.")}
+		return result, nil
+	}
+
+	wn8 := wn8Sum / float64(len(rated))
+	roster.Stats = append(roster.Stats, &Stat{Name: s.t(ctx, "Средний WN8"), Value: fmt.Sprintf("%.0f", wn8), Grade: s.grade(ctx, region, MetricWN8, wn8)})
+	if winrates != 0 {
+		winrate := winrateSum / float64(winrates)
+		roster.Stats = append(roster.Stats, &Stat{Name: s.t(ctx, "Средний процент побед"), Value: fmt.Sprintf("%.2f%%", winrate), Grade: s.grade(ctx, region, MetricWinrate, winrate)})
+	}
+	roster.Stats = append(roster.Stats, &Stat{Name: s.t(ctx, "Со статистикой"), Value: s.t(ctx, "%d из %d", len(rated), len(members))})
+
+	sort.Slice(rated, func(i, j int) bool {
+		return *rated[i].WN8 > *rated[j].WN8
+	})
+
+	best := &Section{Title: s.t(ctx, "Лучшие по WN8"), Ordered: true}
+	for i, m := range rated {
+		if i == clanTopLimit {
+			break
+		}
+		best.Stats = append(best.Stats, &Stat{Name: m.Nickname, Value: fmt.Sprintf("%.0f", *m.WN8), Grade: s.grade(ctx, region, MetricWN8, *m.WN8)})
+	}
+	result.Sections = append(result.Sections, best)
+
+	return result, nil
+}
+
+// clanRoster returns members with stats, only members without fresh cached stats are fetched from Wargaming API
+// in bulk, WN8 is computed locally. Fetching is bounded by roster timeout, members which weren't fetched in time
+// keep stale stats or go without them.
+func (s *service) clanRoster(ctx context.Context, region Region, clan *Clan) ([]*ClanMember, error) {
+	cached, err := s.database.GetClanMembers(ctx, region, clan.ClanID)
+	if err != nil {
+		s.log(ctx).Error("Error getting clan members!", zap.Int("clan_id", clan.ClanID), zap.Error(err))
+		return nil, err
+	}
+
+	stale := make(map[int]*ClanMember, len(cached))
+	for _, m := range cached {
+		stale[m.AccountID] = m
+	}
+
+	members := make([]*ClanMember, len(clan.Members))
+	toCache := make([]*ClanMember, 0, len(clan.Members))
+	var toFetch []int
+	for i, m := range clan.Members {
+		if c, ok := stale[m.AccountID]; ok && time.Since(c.UpdatedAt) < s.config.ClanRosterTTL {
+			// Nickname and role come from live roster, they could change since caching
+			c.Nickname, c.Role = m.Nickname, m.Role
+			members[i] = c
+			toCache = append(toCache, c)
+			continue
+		}
+		toFetch = append(toFetch, i)
+	}
+
+	if len(toFetch) == 0 {
+		if len(cached) == len(toCache) {
+			return members, nil
+		}
+		return members, s.replaceClanMembers(ctx, region, clan, toCache)
+	}
+
+	if err := s.fetchClanMembers(ctx, region, clan, toFetch); err != nil {
+		if ctx.Err() != nil {
+			s.log(ctx).Warn("Clan roster fetching is cancelled!", zap.Int("clan_id", clan.ClanID), zap.Error(ctx.Err()))
+			return nil, ErrInternalWargaming
+		}
+
+		// Stale stats are better than none, they are still cached with old time to be fetched next time
+		s.log(ctx).Warn("Error fetching clan roster!", zap.Int("clan_id", clan.ClanID), zap.Int("members", len(toFetch)), zap.Error(err))
+		for _, i := range toFetch {
+			m := clan.Members[i]
+			if c, ok := stale[m.AccountID]; ok {
+				c.Nickname, c.Role = m.Nickname, m.Role
+				members[i] = c
+				toCache = append(toCache, c)
+				continue
+			}
+			members[i] = m
+		}
+	} else {
+		for _, i := range toFetch {
+			members[i] = clan.Members[i]
+			toCache = append(toCache, clan.Members[i])
+		}
+	}
+
+	if err := s.replaceClanMembers(ctx, region, clan, toCache); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// fetchClanMembers fills stats of clan members with passed indexes, accounts are requested in bulk
+func (s *service) fetchClanMembers(ctx context.Context, region Region, clan *Clan, indexes []int) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.ClanRosterTimeout)
+	defer cancel()
+
+	ids := make([]int, 0, len(indexes))
+	for _, i := range indexes {
+		ids = append(ids, clan.Members[i].AccountID)
+	}
+
+	infos, err := s.wargaming.GetAccountsInfo(ctx, region, ids)
+	if err != nil {
+		return err
+	}
+
+	tanks, err := s.wargaming.GetAccountsTanksStats(ctx, region, ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, i := range indexes {
+		// Players without stats are kept in cache too, so they aren't requested every time
+		m := clan.Members[i]
+		m.UpdatedAt = now
+
+		if info, ok := infos[m.AccountID]; ok && info.Battles != 0 {
+			winrate := float64(info.Wins) / float64(info.Battles) * 100
+			m.Winrate = &winrate
+		}
+
+		wn8, err := s.rating.WN8(tanks[m.AccountID]...)
+		switch {
+		case err == nil:
+			m.WN8 = &wn8
+		case errors.Is(err, ErrExpectedValuesNotFound):
+		default:
+			// Without expected values nobody has WN8, it mustn't be cached
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *service) replaceClanMembers(ctx context.Context, region Region, clan *Clan, members []*ClanMember) error {
+	if err := s.database.ReplaceClanMembers(ctx, region, clan.ClanID, members); err != nil {
+		s.log(ctx).Error("Error replacing clan members!", zap.Int("clan_id", clan.ClanID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// TrackChatMember remembers that user is in the chat, so he appears in /top of it
+func (s *service) TrackChatMember(ctx context.Context, chatID int64, telegramID int) error {
+	if err := s.database.UpsertChatMember(ctx, chatID, telegramID); err != nil {
+		s.log(ctx).Error("Error upserting chat member!", zap.Int64("chat_id", chatID), zap.Int("telegram_id", telegramID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ForgetChatMember removes user who left the chat from its /top
+func (s *service) ForgetChatMember(ctx context.Context, chatID int64, telegramID int) error {
+	if err := s.database.DeleteChatMember(ctx, chatID, telegramID); err != nil {
+		s.log(ctx).Error("Error deleting chat member!", zap.Int64("chat_id", chatID), zap.Int("telegram_id", telegramID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetTopMessage ranks chat members by cached stats, nobody's stats are fetched here
+func (s *service) GetTopMessage(ctx context.Context, chatID int64, metric string) (*Result, error) {
+	top := topMetrics[0]
+	if metric = strings.ToLower(strings.TrimSpace(metric)); metric != "" {
+		found := false
+		for _, m := range topMetrics {
+			for _, name := range m.names {
+				if name == metric {
+					top, found = m, true
+				}
+			}
+		}
+
+		if !found {
+			return nil, ErrBotBadRequest
+		}
+	}
+
+	users, err := s.database.GetChatUsers(ctx, chatID)
+	if err != nil {
+		s.log(ctx).Error("Error getting chat users!", zap.Int64("chat_id", chatID), zap.Error(err))
+		return nil, err
+	}
+
+	type entry struct {
+		nickname string
+		region   Region
+		text     string
+		value    float64
+	}
+
+	entries := make([]*entry, 0, len(users))
+	if len(users) == 0 {
+		return NewTextResult(s.t(ctx, "В этом чате пока никто не сохранил никнейм или не обновил статистику.")), nil
+	}
+
+	// Stats of all members are selected at once, chats could be big
+	userIDs := make([]int, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+	all, err := s.database.GetLatestStatsByUserIDs(ctx, userIDs)
+	if err != nil {
+		s.log(ctx).Error("Error getting latest stats of chat users!", zap.Int64("chat_id", chatID), zap.Error(err))
+		return nil, err
+	}
+	stats := make(map[int][]*XVMStat, len(users))
+	for _, stat := range all {
+		stats[stat.UserID] = append(stats[stat.UserID], stat)
+	}
+
+	for _, user := range users {
+		for _, stat := range stats[user.ID] {
+			if m, ok := s.scales.Metric(stat.Name); !ok || m != top.metric {
+				continue
+			}
+
+			if value, _, ok := stat.Number(); ok && user.Nickname != nil {
+				entries = append(entries, &entry{
+					nickname: *user.Nickname,
+					region:   s.accountRegion(user),
+					text:     *stat.Value,
+					value:    value,
+				})
+			}
+			break
+		}
+	}
+
+	if len(entries) == 0 {
+		return NewTextResult(s.t(ctx, "В этом чате пока никто не сохранил никнейм или не обновил статистику.")), nil
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].value > entries[j].value
+	})
+
+	section := &Section{Title: s.t(ctx, "Топ чата по %s", s.t(ctx, top.title)), Ordered: true}
+	for i, e := range entries {
+		if i == chatTopLimit {
+			break
+		}
+		section.Stats = append(section.Stats, &Stat{Name: e.nickname, Value: e.text, Grade: s.grade(ctx, e.region, top.metric, e.value)})
+	}
+
+	return &Result{
+		Sections: []*Section{section},
+		Footer:   s.t(ctx, "Используется сохранённая статистика, обновить свою можно командой /refresh."),
+	}, nil
+}
+
+func (s *service) GetWargamingStatsMessage(ctx context.Context, telegramID int, query string) (*Result, error) {
+	region, nickname, err := s.resolvePlayerQuery(ctx, telegramID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	nickname, accountID, err := s.wargaming.FindPlayer(ctx, region, nickname)
+	if err != nil {
+		s.log(ctx).Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
+		return nil, err
+	}
+
+	info, err := s.wargaming.GetAccountInfo(ctx, region, accountID)
+	if err != nil {
+		s.log(ctx).Error("Error getting account info!", zap.Int("account_id", accountID), zap.Error(err))
+		return nil, err
+	}
+
+	// WN8 is optional here, the rest of stats is still useful without it
+	var wn8 *Stat
+	if ts, err := s.wargaming.GetTanksStats(ctx, region, accountID); err != nil {
+		s.log(ctx).Error("Error getting tanks stats!", zap.Int("account_id", accountID), zap.Error(err))
+	} else if value, err := s.rating.WN8(ts...); err != nil {
+		s.log(ctx).Error("Error computing WN8!", zap.Int("account_id", accountID), zap.Error(err))
+	} else {
+		wn8 = &Stat{Name: "WN8", Value: fmt.Sprintf("%.0f", value), Grade: s.grade(ctx, region, MetricWN8, value)}
+	}
+
+	return s.accountResult(ctx, region, info, wn8), nil
+}
+
+// accountResult builds player card from Wargaming account info, WN8 is shown if it's passed
+func (s *service) accountResult(ctx context.Context, region Region, info *AccountInfo, wn8 *Stat) *Result {
+	section := &Section{
+		Stats: []*Stat{{Name: s.t(ctx, "Личный рейтинг"), Value: strconv.Itoa(info.GlobalRating)}},
+	}
+	if wn8 != nil {
+		section.Stats = append(section.Stats, wn8)
+	}
+
+	section.Stats = append(section.Stats, &Stat{Name: s.t(ctx, "Бои"), Value: strconv.Itoa(info.Battles)})
+
+	if info.Battles != 0 {
+		battles := float64(info.Battles)
+		winrate := float64(info.Wins) / battles * 100
+		damage := float64(info.DamageDealt) / battles
+		hits := float64(info.HitsPercents)
+		section.Stats = append(
+			section.Stats,
+			&Stat{Name: s.t(ctx, "Процент побед"), Value: fmt.Sprintf("%.2f%%", winrate), Grade: s.grade(ctx, region, MetricWinrate, winrate)},
+			&Stat{Name: s.t(ctx, "Средний урон"), Value: fmt.Sprintf("%.0f", damage), Grade: s.grade(ctx, region, MetricDamage, damage)},
+			&Stat{Name: s.t(ctx, "Уничтожено за бой"), Value: fmt.Sprintf("%.2f", float64(info.Frags)/battles)},
+			&Stat{Name: s.t(ctx, "Обнаружено за бой"), Value: fmt.Sprintf("%.2f", float64(info.Spotted)/battles)},
+			&Stat{Name: s.t(ctx, "Процент выживания"), Value: fmt.Sprintf("%.2f%%", float64(info.SurvivedBattles)/battles*100)},
+			&Stat{Name: s.t(ctx, "Процент попаданий"), Value: fmt.Sprintf("%d%%", info.HitsPercents), Grade: s.grade(ctx, region, MetricHitsPercents, hits)},
+		)
+	}
+
+	section.Stats = append(section.Stats, &Stat{Name: s.t(ctx, "Максимальный опыт"), Value: strconv.Itoa(info.MaxXP)})
+	if !info.LastBattleTime.IsZero() && info.LastBattleTime.Unix() != 0 {
+		section.Stats = append(section.Stats, &Stat{Name: s.t(ctx, "Последний бой"), Value: info.LastBattleTime.UTC().Format("02.01.2006 15:04 UTC")})
+	}
+
+	return &Result{
+		Header: &Header{
+			Label: s.t(ctx, "Игрок"),
+			Name:  info.Nickname,
+			Link:  &Link{Text: s.t(ctx, "на сайте Wargaming"), URL: WargamingPlayerURL(region, info.AccountID, info.Nickname)},
+		},
+		Sections: []*Section{section},
+	}
+}
+
+func (s *service) GetTankStatsMessage(ctx context.Context, telegramID int, query string, vehicle string) (*Result, error) {
+	region, nickname, err := s.resolvePlayerQuery(ctx, telegramID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	vv, err := s.findVehicles(ctx, region, vehicle)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vv) > 1 {
+		section := &Section{}
+		for i, v := range vv {
+			if i == vehiclesSuggestionsLimit {
+				section.Items = append(section.Items, "…")
+				break
+			}
+			section.Items = append(section.Items, s.t(ctx, "%s (%d ур.)", v.Name, v.Tier))
+		}
+
+		return &Result{Text: s.t(ctx, "Найдено несколько машин, уточни название:"), Sections: []*Section{section}}, nil
+	}
+
+	nickname, accountID, err := s.wargaming.FindPlayer(ctx, region, nickname)
+	if err != nil {
+		s.log(ctx).Error("Error getting account_id!", zap.String("nickname", nickname), zap.Error(err))
+		return nil, err
+	}
+
+	ts, err := s.wargaming.GetTankStats(ctx, region, accountID, vv[0].TankID)
+	if err != nil {
+		s.log(ctx).Error("Error getting tank stats!", zap.Int("account_id", accountID), zap.Int("tank_id", vv[0].TankID), zap.Error(err))
+		return nil, err
+	}
+
+	section := &Section{
+		Stats: []*Stat{
+			{Name: s.t(ctx, "Техника"), Value: s.t(ctx, "%s (%d ур.)", vv[0].Name, vv[0].Tier)},
+			{Name: s.t(ctx, "Бои"), Value: strconv.Itoa(ts.Battles)},
+		},
+	}
+	if ts.Battles != 0 {
+		battles := float64(ts.Battles)
+		winrate := float64(ts.Wins) / battles * 100
+		damage := float64(ts.DamageDealt) / battles
+		section.Stats = append(
+			section.Stats,
+			&Stat{Name: s.t(ctx, "Процент побед"), Value: fmt.Sprintf("%.2f%%", winrate), Grade: s.grade(ctx, region, MetricWinrate, winrate)},
+			&Stat{Name: s.t(ctx, "Средний урон"), Value: fmt.Sprintf("%.0f", damage), Grade: s.grade(ctx, region, MetricDamage, damage)},
+			&Stat{Name: s.t(ctx, "Уничтожено за бой"), Value: fmt.Sprintf("%.2f", float64(ts.Frags)/battles)},
+		)
+
+		if wn8, err := s.rating.WN8(ts); err != nil {
+			s.log(ctx).Error("Error computing WN8!", zap.Int("tank_id", ts.TankID), zap.Error(err))
+		} else {
+			section.Stats = append(section.Stats, &Stat{Name: "WN8", Value: fmt.Sprintf("%.0f", wn8), Grade: s.grade(ctx, region, MetricWN8, wn8)})
+		}
+	}
+	section.Stats = append(section.Stats, &Stat{Name: s.t(ctx, "Знак классности"), Value: s.t(ctx, masteryBadges[ts.MarkOfMastery])})
+
+	return &Result{
+		Header:   &Header{Label: s.t(ctx, "Игрок"), Name: nickname},
+		Sections: []*Section{section},
+	}, nil
+}
+
+// grade finds rating grade of the value, nil means there is no scale for the metric
+func (s *service) grade(ctx context.Context, region Region, metric Metric, value float64) *Grade {
+	if metric == "" {
+		return nil
+	}
+
+	g := s.scales.Grade(region, metric, value)
+	if g == nil {
+		return nil
+	}
+
+	// Labels of built-in scales are in catalog, custom ones are shown as they are
+	return &Grade{Label: s.t(ctx, g.Label), Emoji: g.Emoji}
+}
+
+// xvmStat converts XVM stat to result one, scale is matched by displayed name of the stat
+func (s *service) xvmStat(ctx context.Context, region Region, stat *XVMStat) *Stat {
+	result := &Stat{
+		Name:  s.t(ctx, stat.Name),
+		Value: *stat.Value,
+	}
+
+	if metric, ok := s.scales.Metric(stat.Name); ok {
+		if value, _, ok := stat.Number(); ok {
+			result.Grade = s.grade(ctx, region, metric, value)
+		}
+	}
+
+	return result
+}
+
+func (s *service) xvmHeader(ctx context.Context, region Region, nickname string, accountID int) *Header {
+	return &Header{
+		Label: s.t(ctx, "Игрок"),
+		Name:  nickname,
+		Link:  &Link{Text: s.t(ctx, "на сайте XVM"), URL: XVMPlayerURL(region, accountID)},
+	}
+}
+
+// findVehicles looks up vehicle in local catalog which is refreshed from Wargaming API when it becomes stale
+func (s *service) findVehicles(ctx context.Context, region Region, name string) ([]*Vehicle, error) {
+	vv, err := s.database.GetVehicles(ctx, region)
+	if err != nil {
+		s.log(ctx).Error("Error getting vehicles!", zap.String("region", string(region)), zap.Error(err))
+		return nil, err
+	}
+
+	if len(vv) == 0 || time.Since(vv[0].UpdatedAt) > s.config.VehiclesTTL {
+		fresh, err := s.wargaming.GetVehicles(ctx, region)
+		if err != nil {
+			s.log(ctx).Error("Error getting vehicles from Wargaming API!", zap.String("region", string(region)), zap.Error(err))
+			// Stale catalog is still better than nothing
+			if len(vv) == 0 {
+				return nil, err
+			}
+		} else {
+			if err := s.database.ReplaceVehicles(ctx, region, fresh); err != nil {
+				s.log(ctx).Error("Error replacing vehicles!", zap.String("region", string(region)), zap.Error(err))
+				return nil, err
+			}
+
+			// Same order as in database: top tiers first
+			sort.Slice(fresh, func(i, j int) bool {
+				if fresh[i].Tier != fresh[j].Tier {
+					return fresh[i].Tier > fresh[j].Tier
+				}
+				return fresh[i].Name < fresh[j].Name
+			})
+			vv = fresh
+		}
+	}
+
+	name = normalizeVehicleName(name)
+	if name == "" {
+		return nil, ErrVehicleNotFound
+	}
+
+	var partial []*Vehicle
+	for _, v := range vv {
+		if normalizeVehicleName(v.ShortName) == name || normalizeVehicleName(v.Name) == name {
+			return []*Vehicle{v}, nil
+		}
+
+		if strings.Contains(normalizeVehicleName(v.Name), name) || strings.Contains(normalizeVehicleName(v.ShortName), name) {
+			partial = append(partial, v)
+		}
+	}
+
+	if len(partial) == 0 {
+		return nil, ErrVehicleNotFound
+	}
+
+	return partial, nil
+}
+
+// normalizeVehicleName makes names like "Obj. 140" and "obj140" comparable
+func normalizeVehicleName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == 'ё':
+			return 'е'
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return r
+		}
+		return -1
+	}, strings.ToLower(name))
+}
+
+func (s *service) GetInlineQueryResults(ctx context.Context, telegramID int, query string) ([]*InlineResult, error) {
+	region, query, err := s.resolvePlayerQuery(ctx, telegramID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wargaming API doesn't search by less than three symbols
+	if len([]rune(query)) < 3 {
+		return nil, nil
+	}
+
+	players, err := s.wargaming.SearchPlayers(ctx, region, query, inlineSuggestionsLimit)
+	if err != nil {
+		s.log(ctx).Error("Error searching players!", zap.String("query", query), zap.Error(err))
+		return nil, err
+	}
+
+	results := make([]*InlineResult, 0, len(players)+2)
+	for _, p := range players {
+		if strings.ToLower(p.Nickname) != strings.ToLower(query) {
+			continue
+		}
+
+		// Exact match gets full stats cards from both sources. Inline queries come on every typed symbol,
+		// upstream adapters are wrapped with cache, so repeated queries are answered from it.
+		var (
+			wg              sync.WaitGroup
+			xvmMsg, kttcMsg *Result
+			xvmErr, kttcErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			xvmMsg, xvmErr = s.statsMessage(ctx, region, p.Nickname, p.AccountID)
+		}()
+		go func() {
+			defer wg.Done()
+			kttcMsg, kttcErr = s.kttcStatsMessage(ctx, region, p.Nickname, p.AccountID, kttcDefaultWindow, false)
+		}()
+		wg.Wait()
+
+		if xvmErr == nil {
+			results = append(results, &InlineResult{
+				ID:          fmt.Sprintf("xvm:%d", p.AccountID),
+				Title:       p.Nickname,
+				Description: s.t(ctx, "Статистика XVM"),
+				Result:      xvmMsg,
+			})
+		}
+		if kttcErr == nil {
+			results = append(results, &InlineResult{
+				ID:          fmt.Sprintf("kttc:%d", p.AccountID),
+				Title:       p.Nickname,
+				Description: s.t(ctx, "Статистика KTTC %s", s.kttcWindowTitle(ctx, kttcDefaultWindow)),
+				Result:      kttcMsg,
+			})
+		}
+
+		break
+	}
+
+	// Other search results are suggestions with links only, fetching stats for each of them is too expensive
+	for _, p := range players {
+		results = append(results, &InlineResult{
+			ID:          fmt.Sprintf("player:%d", p.AccountID),
+			Title:       p.Nickname,
+			Description: s.t(ctx, "Ссылки на профиль игрока"),
+			Result: &Result{
+				Header: &Header{Label: s.t(ctx, "Игрок"), Name: p.Nickname},
+				Sections: []*Section{{
+					Links: []*Link{
+						{Text: "XVM", URL: XVMPlayerURL(region, p.AccountID)},
+						{Text: "KTTC", URL: KTTCPlayerURL(region, p.Nickname)},
+					},
+				}},
+			},
+		})
+	}
+
+	return results, nil
+}
+
+func (s *service) GetRegionMessage(ctx context.Context, telegramID int, region string) (*Result, error) {
+	if region == "" {
+		user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+			return nil, err
+		}
+
+		return NewTextResult(s.t(ctx, "Текущий регион: %s", strings.ToUpper(string(s.userRegion(user))))), nil
+	}
+
+	r, err := ParseRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.database.UpsertUser(ctx, &User{
+		TelegramID: telegramID,
+		Region:     &r,
+	}); err != nil {
+		s.log(ctx).Error("Error upserting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	return NewTextResult(s.t(ctx, "Регион по умолчанию изменён на %s.", strings.ToUpper(string(r)))), nil
+}
+
+// GetLanguage returns language chosen with /lang, Telegram client language is used until user chooses one
+func (s *service) GetLanguage(ctx context.Context, telegramID int, languageCode string) (i18n.Lang, error) {
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return "", err
+	}
+
+	if user != nil && user.Language != nil {
+		return *user.Language, nil
+	}
+
+	// Client language is remembered for messages sent without update, e.g. notifications
+	switch {
+	case user == nil:
+	case languageCode == "":
+		if user.LanguageCode != nil {
+			languageCode = *user.LanguageCode
+		}
+	case user.LanguageCode == nil || *user.LanguageCode != languageCode:
+		if _, err := s.database.UpsertUser(ctx, &User{
+			TelegramID:   telegramID,
+			LanguageCode: &languageCode,
+		}); err != nil {
+			// Language of the current update is known anyway
+			s.log(ctx).Warn("Error saving client language!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		}
+	}
+
+	return i18n.Match(languageCode), nil
+}
+
+func (s *service) GetLanguageMessage(ctx context.Context, telegramID int, lang string) (*Result, error) {
+	if lang == "" {
+		return NewTextResult(s.t(ctx, "Текущий язык: %s, доступны: ru, en.", i18n.FromContext(ctx))), nil
+	}
+
+	l, err := i18n.Parse(lang)
+	if err != nil {
+		return nil, ErrUnknownLanguage
+	}
+
+	if _, err := s.database.UpsertUser(ctx, &User{
+		TelegramID: telegramID,
+		Language:   &l,
+	}); err != nil {
+		s.log(ctx).Error("Error upserting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return nil, err
+	}
+
+	// Answer is already in the new language
+	return NewTextResult(s.t(i18n.WithLang(ctx, l), "Язык изменён на %s.", l)), nil
+}
+
+// log returns logger with request fields from context
+func (s *service) log(ctx context.Context) *zap.Logger {
+	return Logger(ctx, s.logger)
+}
+
+// t translates message to language of the request
+func (s *service) t(ctx context.Context, format string, args ...interface{}) string {
+	return i18n.Sprintf(i18n.FromContext(ctx), format, args...)
+}
+
+// userRegion returns region chosen by user or the default one
+func (s *service) userRegion(user *User) Region {
+	if user == nil || user.Region == nil {
+		return s.config.DefaultRegion
+	}
+
+	return *user.Region
+}
+
+// accountRegion returns region of the saved account, users saved before it was stored separately have the default one
+func (s *service) accountRegion(user *User) Region {
+	if user == nil || user.WargamingRegion == nil {
+		return s.userRegion(user)
+	}
+
+	return *user.WargamingRegion
+}
+
+// resolvePlayerQuery returns region from query prefix (e.g. eu:nickname) or user's default region
+func (s *service) resolvePlayerQuery(ctx context.Context, telegramID int, query string) (Region, string, error) {
+	region, nickname, err := ParsePlayerQuery(query)
+	if err != nil {
+		return "", "", err
+	}
+
+	if region != nil {
+		return *region, nickname, nil
+	}
+
+	user, err := s.database.GetUserByTelegramID(ctx, telegramID)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		s.log(ctx).Error("Error getting user!", zap.Int("telegram_id", telegramID), zap.Error(err))
+		return "", "", err
 	}
 
-	return msg, nil
+	return s.userRegion(user), nickname, nil
 }
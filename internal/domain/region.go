@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type Region string
+
+const (
+	RegionRU   Region = "ru"
+	RegionEU   Region = "eu"
+	RegionNA   Region = "na"
+	RegionASIA Region = "asia"
+)
+
+var Regions = []Region{RegionRU, RegionEU, RegionNA, RegionASIA}
+
+func ParseRegion(s string) (Region, error) {
+	r := Region(strings.ToLower(strings.TrimSpace(s)))
+	for _, region := range Regions {
+		if r == region {
+			return r, nil
+		}
+	}
+
+	return "", ErrUnknownRegion
+}
+
+// ParsePlayerQuery splits optional region prefix (e.g. eu:nickname) from nickname
+func ParsePlayerQuery(query string) (*Region, string, error) {
+	query = strings.TrimSpace(query)
+
+	parts := strings.SplitN(query, ":", 2)
+	if len(parts) != 2 {
+		return nil, query, nil
+	}
+
+	r, err := ParseRegion(parts[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &r, strings.TrimSpace(parts[1]), nil
+}
+
+// XVMPlayerURL returns player page on XVM website, it has only Russian and English versions
+func XVMPlayerURL(region Region, accountID int) string {
+	lang := "en"
+	if region == RegionRU {
+		lang = "ru"
+	}
+
+	return fmt.Sprintf("https://stats.modxvm.com/%s/stat/players/%d", lang, accountID)
+}
+
+func KTTCPlayerURL(region Region, nickname string) string {
+	return fmt.Sprintf("https://kttc.ru/wot/%s/user/%s/", region, url.PathEscape(nickname))
+}
+
+func WargamingPlayerURL(region Region, accountID int, nickname string) string {
+	host, lang := "worldoftanks.ru", "ru"
+	switch region {
+	case RegionEU:
+		host, lang = "worldoftanks.eu", "en"
+	case RegionNA:
+		host, lang = "worldoftanks.com", "en"
+	case RegionASIA:
+		host, lang = "worldoftanks.asia", "en"
+	}
+
+	return fmt.Sprintf("https://%s/%s/community/accounts/%d-%s/", host, lang, accountID, url.PathEscape(nickname))
+}
+
+func WargamingClanURL(region Region, clanID int) string {
+	return fmt.Sprintf("https://%s.wargaming.net/clans/wot/%d/", region, clanID)
+}
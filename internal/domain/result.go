@@ -0,0 +1,67 @@
+package domain
+
+// Result is structured service response, frontends turn it into message text with renderer package
+type Result struct {
+	Header   *Header
+	Text     string
+	Sections []*Section
+	Footer   string
+}
+
+// Header names the entity result is about, e.g. player with link to his profile
+type Header struct {
+	Label string
+	Name  string
+	Link  *Link
+}
+
+type Link struct {
+	Text string
+	URL  string
+}
+
+type Section struct {
+	Title string
+	// Ordered sections are numbered, e.g. leaderboards
+	Ordered bool
+	Stats   []*Stat
+	Items   []string
+	Table   *Table
+	Links   []*Link
+}
+
+type Stat struct {
+	Name  string
+	Value string
+	// Previous value is set if stat describes a change, e.g. in notifications
+	Previous string
+	Delta    *Delta
+	Grade    *Grade
+}
+
+type Delta struct {
+	Value     float64
+	Precision int
+	Percent   bool
+}
+
+// Table compares several columns, e.g. players, cells of every row go in columns order
+type Table struct {
+	Columns []string
+	Rows    []*TableRow
+}
+
+type TableRow struct {
+	Title string
+	Cells []*TableCell
+}
+
+// TableCell is empty if there is no value, Best marks the leader of the row
+type TableCell struct {
+	Text string
+	Best bool
+}
+
+func NewTextResult(text string) *Result {
+	return &Result{Text: text}
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/L11R/wotbot/internal/i18n"
+	"go.uber.org/zap"
+)
+
+// testScales grades every value above 1000 as good and knows winrate by its Russian name only
+type testScales struct{}
+
+func (testScales) Grade(region Region, metric Metric, value float64) *Grade {
+	if value > 1000 {
+		return &Grade{Label: "Хорошо", Emoji: "💚"}
+	}
+	return &Grade{Label: "Плохо", Emoji: "❤️"}
+}
+
+func (testScales) Metric(name string) (Metric, bool) {
+	if name == "Процент побед" {
+		return MetricWinrate, true
+	}
+	return "", false
+}
+
+func newTestService() *service {
+	return &service{
+		logger: zap.NewNop(),
+		config: &Config{DefaultRegion: RegionRU},
+		scales: testScales{},
+	}
+}
+
+func TestNewTextResult(t *testing.T) {
+	want := &Result{Text: "Готово"}
+	if got := NewTextResult("Готово"); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewTextResult() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCompareTable(t *testing.T) {
+	rows := []*compareRow{
+		{title: "WN8", texts: []string{"1500", "2000", ""}, values: []float64{1500, 2000, 0}, known: []bool{true, true, false}},
+		{title: "Бои", texts: []string{"100", "100"}, values: []float64{100, 100}, known: []bool{true, true}},
+		// Single known value has nothing to be compared with
+		{title: "WTR", texts: []string{"", "5000"}, values: []float64{0, 5000}, known: []bool{false, true}},
+	}
+
+	table := compareTable([]string{"a", "b", "c"}, rows)
+	if !reflect.DeepEqual(table.Columns, []string{"a", "b", "c"}) {
+		t.Errorf("columns = %v", table.Columns)
+	}
+
+	want := [][]bool{
+		{false, true, false},
+		{true, true},
+		{false, false},
+	}
+	for i, row := range table.Rows {
+		if row.Title != rows[i].title {
+			t.Errorf("row %d title = %q, want %q", i, row.Title, rows[i].title)
+		}
+
+		var best []bool
+		for j, cell := range row.Cells {
+			if cell.Text != rows[i].texts[j] {
+				t.Errorf("row %d cell %d text = %q, want %q", i, j, cell.Text, rows[i].texts[j])
+			}
+			best = append(best, cell.Best)
+		}
+		if !reflect.DeepEqual(best, want[i]) {
+			t.Errorf("row %d best = %v, want %v", i, best, want[i])
+		}
+	}
+}
+
+func TestFindCompareRow(t *testing.T) {
+	var rows []*compareRow
+
+	first := findCompareRow(&rows, "winrate", "Процент побед", 2)
+	// The same metric shown under another name goes to the same row
+	second := findCompareRow(&rows, "winrate", "Win rate", 2)
+	other := findCompareRow(&rows, "battles", "Бои", 2)
+
+	if first != second {
+		t.Error("rows with the same key are different")
+	}
+	if first == other || len(rows) != 2 {
+		t.Errorf("rows = %d, want 2", len(rows))
+	}
+	if first.title != "Процент побед" || len(first.texts) != 2 {
+		t.Errorf("row = %+v", first)
+	}
+}
+
+func TestAccountResult(t *testing.T) {
+	s := newTestService()
+	info := &AccountInfo{
+		AccountID:    1,
+		Nickname:     "player",
+		GlobalRating: 5000,
+		Battles:      200,
+		Wins:         110,
+		DamageDealt:  300000,
+		HitsPercents: 70,
+		MaxXP:        2500,
+	}
+
+	ctx := i18n.WithLang(context.Background(), i18n.English)
+	result := s.accountResult(ctx, RegionEU, info, &Stat{Name: "WN8", Value: "1800"})
+
+	if result.Header == nil || result.Header.Label != "Player" || result.Header.Name != "player" {
+		t.Fatalf("header = %+v", result.Header)
+	}
+	if result.Header.Link == nil || result.Header.Link.URL != WargamingPlayerURL(RegionEU, 1, "player") {
+		t.Errorf("link = %+v", result.Header.Link)
+	}
+
+	stats := map[string]*Stat{}
+	for _, stat := range result.Sections[0].Stats {
+		stats[stat.Value] = stat
+	}
+
+	if stat, ok := stats["1800"]; !ok || stat.Name != "WN8" {
+		t.Errorf("passed WN8 stat is missing: %+v", stat)
+	}
+	if stat, ok := stats["55.00%"]; !ok || stat.Grade == nil || stat.Grade.Emoji != "❤️" {
+		t.Errorf("winrate stat = %+v", stat)
+	}
+	if stat, ok := stats["1500"]; !ok || stat.Grade == nil || stat.Grade.Emoji != "💚" {
+		t.Errorf("damage stat = %+v", stat)
+	}
+	if _, ok := stats["5000"]; !ok {
+		t.Error("personal rating is missing")
+	}
+}
+
+func TestAccountResultWithoutBattles(t *testing.T) {
+	s := newTestService()
+	result := s.accountResult(context.Background(), RegionRU, &AccountInfo{Nickname: "new"}, nil)
+
+	// Averages aren't computed without battles
+	for _, stat := range result.Sections[0].Stats {
+		if stat.Name == "Процент побед" || stat.Name == "Средний урон" {
+			t.Errorf("unexpected stat %q", stat.Name)
+		}
+	}
+}
+
+func TestXVMStat(t *testing.T) {
+	s := newTestService()
+	value := "52,3%"
+	stat := s.xvmStat(context.Background(), RegionRU, &XVMStat{Name: "Процент побед", Value: &value})
+
+	if stat.Name != "Процент побед" || stat.Value != value {
+		t.Errorf("stat = %+v", stat)
+	}
+	if stat.Grade == nil || stat.Grade.Label != "Плохо" {
+		t.Errorf("grade = %+v", stat.Grade)
+	}
+
+	value = "100"
+	if stat := s.xvmStat(context.Background(), RegionRU, &XVMStat{Name: "Unknown", Value: &value}); stat.Grade != nil {
+		t.Errorf("unknown stat grade = %+v, want nil", stat.Grade)
+	}
+}
@@ -1,14 +1,107 @@
 package domain
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/L11R/wotbot/internal/i18n"
+)
 
 type User struct {
-	ID          int        `db:"id"`
-	TelegramID  int        `db:"telegram_id"`
-	Nickname    *string    `db:"nickname"`
-	WargamingID *int       `db:"wargaming_id"`
-	CreatedAt   time.Time  `db:"created_at"`
-	UpdatedAt   *time.Time `db:"updated_at"`
+	ID          int     `db:"id"`
+	TelegramID  int     `db:"telegram_id"`
+	Nickname    *string `db:"nickname"`
+	WargamingID *int    `db:"wargaming_id"`
+	// Region the saved account belongs to, it's set by /save only
+	WargamingRegion *Region `db:"wargaming_region"`
+	// Region of lookups by nickname, it's chosen with /region
+	Region      *Region    `db:"region"`
+	AutoRefresh *bool      `db:"auto_refresh"`
+	Language    *i18n.Lang `db:"language"`
+	// Language of Telegram client, it's used for messages sent without update if user didn't choose one
+	LanguageCode *string    `db:"language_code"`
+	RefreshedAt  *time.Time `db:"refreshed_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+	UpdatedAt    *time.Time `db:"updated_at"`
+}
+
+type Player struct {
+	Nickname  string
+	AccountID int
+}
+
+type AccountInfo struct {
+	AccountID       int
+	Nickname        string
+	GlobalRating    int
+	LastBattleTime  time.Time
+	Battles         int
+	Wins            int
+	Losses          int
+	Draws           int
+	DamageDealt     int
+	Frags           int
+	Spotted         int
+	SurvivedBattles int
+	HitsPercents    int
+	MaxXP           int
+}
+
+type Vehicle struct {
+	Region    Region    `db:"region"`
+	TankID    int       `db:"tank_id"`
+	Name      string    `db:"name"`
+	ShortName string    `db:"short_name"`
+	Tier      int       `db:"tier"`
+	Type      string    `db:"type"`
+	Nation    string    `db:"nation"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type Clan struct {
+	ClanID       int
+	Tag          string
+	Name         string
+	MembersCount int
+	LeaderName   string
+	CreatedAt    time.Time
+	Members      []*ClanMember
+}
+
+// ClanMember is a roster entry, stats are cached and nil if player has no KTTC stats
+type ClanMember struct {
+	Region    Region    `db:"region"`
+	ClanID    int       `db:"clan_id"`
+	AccountID int       `db:"account_id"`
+	Nickname  string    `db:"nickname"`
+	Role      string    `db:"role"`
+	WN8       *float64  `db:"wn8"`
+	Winrate   *float64  `db:"winrate"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type TankStats struct {
+	TankID               int
+	MarkOfMastery        int
+	Battles              int
+	Wins                 int
+	DamageDealt          int
+	Frags                int
+	Spotted              int
+	DroppedCapturePoints int
+	SurvivedBattles      int
+}
+
+type InlineResult struct {
+	ID          string
+	Title       string
+	Description string
+	Result      *Result
 }
 
 type XVMStatType string
@@ -18,21 +111,159 @@ const (
 	XVMVehicleStat XVMStatType = "vehicle"
 )
 
+// Subscription keeps the last values user was notified about, so every change is reported once
+type Subscription struct {
+	UserID     int        `db:"user_id"`
+	TelegramID int        `db:"telegram_id"`
+	MinChange  float64    `db:"min_change"`
+	SnapshotID *int       `db:"snapshot_id"`
+	KTTCValues StatValues `db:"kttc_values"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UpdatedAt  *time.Time `db:"updated_at"`
+}
+
+// StatValues are stat values keyed by name, stored as JSON
+type StatValues map[string]float64
+
+func (v StatValues) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(v)
+}
+
+func (v *StatValues) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, v)
+	case string:
+		return json.Unmarshal([]byte(src), v)
+	}
+
+	return fmt.Errorf("unsupported stat values type: %T", src)
+}
+
+type Snapshot struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	Stats     []*XVMStat `db:"-"`
+}
+
 type XVMStat struct {
-	ID        int         `db:"id"`
-	UserID    int         `db:"user_id"`
-	Type      XVMStatType `db:"type"`
-	Name      string      `db:"name"`
-	Value     *string     `db:"value"`
-	HtmlID    string      `db:"html_id"`
-	Image     []byte      `db:"img"`
-	CreatedAt time.Time   `db:"created_at"`
-	UpdatedAt *time.Time  `db:"updated_at"`
+	ID         int         `db:"id"`
+	UserID     int         `db:"user_id"`
+	SnapshotID int         `db:"snapshot_id"`
+	Type       XVMStatType `db:"type"`
+	Name       string      `db:"name"`
+	Value      *string     `db:"value"`
+	HtmlID     string      `db:"html_id"`
+	Image      []byte      `db:"img"`
+	CreatedAt  time.Time   `db:"created_at"`
+	UpdatedAt  *time.Time  `db:"updated_at"`
+}
+
+// KTTCWindow is KTTC stats for the latest battles, e.g. "1000", or for the whole account
+type KTTCWindow struct {
+	Key   string
+	Date  string
+	Stats []*KTTCStat
 }
 
 type KTTCStat struct {
-	Name  string
-	Value float64
-	Color string
-	Delta *float64
+	Name      string
+	Metric    Metric
+	Value     float64
+	Precision int
+	// Extended stats are shown only on request
+	Extended bool
+	Delta    *float64
+}
+
+// Metric identifies rating scale which is applied to a stat value
+type Metric string
+
+const (
+	MetricWN8          Metric = "wn8"
+	MetricWTR          Metric = "wtr"
+	MetricWinrate      Metric = "winrate"
+	MetricDamage       Metric = "damage"
+	MetricHitsPercents Metric = "hits_percents"
+	MetricBattles      Metric = "battles"
+)
+
+// Grade is a band of rating scale the value falls into
+type Grade struct {
+	Label string
+	Emoji string
+}
+
+// Number parses displayed value (e.g. "1 580" or "52.3%") and returns it with the count of decimal places
+func (s *XVMStat) Number() (float64, int, bool) {
+	if s.Value == nil {
+		return 0, 0, false
+	}
+
+	return parseNumber(*s.Value)
+}
+
+// parseNumber parses number formatted by any XVM locale: RU pages use "1 580" and "52,3", English ones "1,580" and "52.3".
+// Comma is decimal separator only if there is no dot and it isn't followed by a group of three digits.
+func parseNumber(value string) (float64, int, bool) {
+	v := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '%' {
+			return -1
+		}
+		return r
+	}, value)
+
+	comma, dot := strings.LastIndexByte(v, ','), strings.LastIndexByte(v, '.')
+	switch {
+	case comma != -1 && dot != -1:
+		// The last separator is decimal one, e.g. "1,580.5" or "1.580,5"
+		if comma > dot {
+			v = strings.Replace(strings.Replace(v, ".", "", -1), ",", ".", 1)
+		} else {
+			v = strings.Replace(v, ",", "", -1)
+		}
+	case comma != -1:
+		if strings.Count(v, ",") == 1 && !isDigitGroup(v[:comma], v[comma+1:]) {
+			v = strings.Replace(v, ",", ".", 1)
+		} else {
+			v = strings.Replace(v, ",", "", -1)
+		}
+	case dot != -1 && strings.Count(v, ".") > 1:
+		v = strings.Replace(v, ".", "", -1)
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	precision := 0
+	if i := strings.IndexByte(v, '.'); i != -1 {
+		precision = len(v) - i - 1
+	}
+
+	return n, precision, true
+}
+
+// isDigitGroup reports if part after separator is thousands group, groups never follow leading zero
+func isDigitGroup(before, after string) bool {
+	if len(after) != 3 {
+		return false
+	}
+	for _, r := range after {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	before = strings.TrimLeft(before, "+-")
+	return before != "" && before != "0"
 }
@@ -0,0 +1,43 @@
+package domain
+
+import "testing"
+
+func TestXVMStatNumber(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      float64
+		precision int
+		ok        bool
+	}{
+		{"1 580", 1580, 0, true},
+		{"1\u00a0580", 1580, 0, true},
+		{"1\u202f580", 1580, 0, true},
+		{"52,3%", 52.3, 1, true},
+		{"1,580", 1580, 0, true},
+		{"52.3%", 52.3, 1, true},
+		{"1,580,000", 1580000, 0, true},
+		{"1,580.25", 1580.25, 2, true},
+		{"1.580,25", 1580.25, 2, true},
+		{"1.580.000", 1580000, 0, true},
+		{"0,580", 0.58, 3, true},
+		{"-1,5", -1.5, 1, true},
+		{"1,5800", 1.58, 4, true},
+		{"1 580,75", 1580.75, 2, true},
+		{"-", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			value := tt.value
+			got, precision, ok := (&XVMStat{Value: &value}).Number()
+			if ok != tt.ok || got != tt.want || precision != tt.precision {
+				t.Errorf("Number() = %v, %d, %v; want %v, %d, %v", got, precision, ok, tt.want, tt.precision, tt.ok)
+			}
+		})
+	}
+
+	if _, _, ok := (&XVMStat{}).Number(); ok {
+		t.Error("Number() of stat without value succeeded")
+	}
+}
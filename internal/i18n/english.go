@@ -0,0 +1,154 @@
+package i18n
+
+var english = map[string]string{
+	// Help
+	"Привет.": "Hi.",
+	"Команды": "Commands",
+	"/get nickname — запрашивает и отображает статистику игрока.":                                              "/get nickname — fetches and shows player stats.",
+	"/kttc nickname [окно] [full] — статистика KTTC за последние 100, 500, 1000… боёв, full — все показатели.": "/kttc nickname [window] [full] — KTTC stats for the last 100, 500, 1000… battles, full shows all metrics.",
+	"/wg nickname — официальная статистика игрока из Wargaming API.":                                           "/wg nickname — official player stats from Wargaming API.",
+	"/clan TAG — информация о клане и статистика его состава.":                                                 "/clan TAG — clan info and stats of its members.",
+	"/top [wn8|winrate|damage|battles] — рейтинг участников группы, сохранивших никнейм.":                      "/top [wn8|winrate|damage|battles] — leaderboard of group members who saved their nickname.",
+	"/compare nickname1 nickname2 … — сравнивает показатели нескольких игроков.":                               "/compare nickname1 nickname2 … — compares stats of several players.",
+	"/tank nickname танк — статистика игрока на конкретной технике.":                                           "/tank nickname vehicle — player stats on the vehicle.",
+	"/save nickname — позволяет сохранить свой никнейм.":                                                       "/save nickname — saves your nickname.",
+	"/region [ru|eu|na|asia] — показывает или меняет регион по умолчанию.":                                     "/region [ru|eu|na|asia] — shows or changes default region.",
+	"Регион можно указать и прямо в никнейме: /get eu:nickname.":                                               "Region can be passed right in nickname: /get eu:nickname.",
+	"/lang [ru|en] — показывает или меняет язык бота.":                                                         "/lang [ru|en] — shows or changes bot language.",
+	"/me — выводит расширенную статистику по сохранённому никнейму.":                                           "/me — shows extended stats of saved nickname.",
+	"/refresh — обновляет кэш.": "/refresh — refreshes cache.",
+	"/autorefresh [on|off] — включает или выключает автоматическое обновление статистики.":          "/autorefresh [on|off] — turns scheduled stats refresh on or off.",
+	"/notify [on [порог %]|off] — уведомления о смене цвета показателей или их заметном изменении.": "/notify [on [threshold %]|off] — notifications about rating color or notable stats changes.",
+	"/diff [период] — показывает изменения показателей, например за 7d или 2w.":                     "/diff [period] — shows stats changes, e.g. for 7d or 2w.",
+	"Кстати, ты уже сохранил свой никнейм, приветствую %s!":                                         "By the way, you've already saved your nickname, welcome %s!",
+
+	// Settings
+	"Твой никнейм сохранён, ты можешь посмотреть свою статистику здесь: /me": "Your nickname is saved, you can see your stats here: /me",
+	"Статистика обновлена!":                                                   "Stats are refreshed!",
+	"Автообновление статистики включено.":                                     "Scheduled stats refresh is on.",
+	"Автообновление статистики выключено.":                                    "Scheduled stats refresh is off.",
+	"Автообновление статистики включено, /me будет обновляться без /refresh.": "Scheduled stats refresh is on, /me will be updated without /refresh.",
+	"Уведомления выключены.":                                                  "Notifications are off.",
+	"Уведомления включены, порог изменения: %g%%.":                            "Notifications are on, change threshold: %g%%.",
+	"Уведомления включены: пришлю сообщение, если показатель сменит цвет или изменится больше чем на %g%%.": "Notifications are on: I'll write if a metric changes its color or changes by more than %g%%.",
+	"Текущий регион: %s":                  "Current region: %s",
+	"Регион по умолчанию изменён на %s.":  "Default region is changed to %s.",
+	"Текущий язык: %s, доступны: ru, en.": "Current language: %s, available: ru, en.",
+	"Язык изменён на %s.":                 "Language is changed to %s.",
+
+	// Stats
+	"Игрок": "Player",
+	"Статистика изменилась!":                     "Stats have changed!",
+	"Изменения с %s по %s":                       "Changes from %s to %s",
+	"Показатели не найдены.":                     "No stats found.",
+	"Статистика за %s не найдена, доступны: %s.": "Stats for %s aren't found, available: %s.",
+	"Статистика %s":                              "Stats %s",
+	"на сайте KTTC":                              "on KTTC",
+	"на сайте XVM":                               "on XVM",
+	"на сайте Wargaming":                         "on Wargaming",
+	"Данные на %s":                               "Data as of %s",
+	"за последние %s боёв":                       "for the last %s battles",
+	"за всё время":                               "for all time",
+	"Сравнение игроков":                          "Players comparison",
+	"Значения идут в том же порядке, %s отмечен лучший.": "Values go in the same order, the best one is marked with %s.",
+	", теперь %s":              ", now %s",
+	"Статистика XVM":           "XVM stats",
+	"Статистика KTTC %s":       "KTTC stats %s",
+	"Ссылки на профиль игрока": "Player profile links",
+	"Личный рейтинг":           "Personal rating",
+	"Максимальный опыт":        "Max experience",
+	"Последний бой":            "Last battle",
+	"Техника":                  "Vehicle",
+	"%s (%d ур.)":              "%s (tier %d)",
+	"Знак классности":          "Mastery badge",
+	"Найдено несколько машин, уточни название:": "Several vehicles are found, specify the name:",
+	"нет":       "none",
+	"3 степень": "3rd class",
+	"2 степень": "2nd class",
+	"1 степень": "1st class",
+	"Мастер":    "Ace Tanker",
+
+	// Metrics, KTTC and XVM stats names
+	"Бои":                     "Battles",
+	"Боёв":                    "Battles",
+	"Победы":                  "Wins",
+	"Поражения":               "Losses",
+	"Ничьи":                   "Draws",
+	"Процент побед":           "Win rate",
+	"Урон":                    "Damage",
+	"Средний урон":            "Average damage",
+	"Уничтожено за бой":       "Frags per battle",
+	"Обнаружено за бой":       "Spotted per battle",
+	"Процент выживания":       "Survival rate",
+	"Процент попаданий":       "Hit ratio",
+	"Процент попадений":       "Hit ratio",
+	"Средний уровень техники": "Average vehicle tier",
+	"Средний уровень боёв":    "Average battle tier",
+	"Заблокированный урон":    "Blocked damage",
+	"Средний опыт":            "Average experience",
+	"Очки захвата за бой":     "Capture points per battle",
+	"Очки защиты за бой":      "Defense points per battle",
+
+	// Rating grades
+	"Плохо":         "Bad",
+	"Ниже среднего": "Below average",
+	"Хорошо":        "Good",
+	"Отлично":       "Great",
+	"Уникум":        "Unicum",
+
+	// Clans and leaderboards
+	"Клан":      "Clan",
+	"Участники": "Members",
+	"Командир":  "Commander",
+	"Создан":    "Created",
+	"Состав, Wargaming за всё время":    "Members, Wargaming for all time",
+	"Статистика участников не найдена.": "Members stats aren't found.",
+	"Средний WN8":           "Average WN8",
+	"Средний процент побед": "Average win rate",
+	"Со статистикой":        "With stats",
+	"%d из %d":              "%d of %d",
+	"Лучшие по WN8":         "Best by WN8",
+	"Топ чата по %s":        "Chat top by %s",
+	"проценту побед":        "win rate",
+	"среднему урону":        "average damage",
+	"количеству боёв":       "battles count",
+	"В этом чате пока никто не сохранил никнейм или не обновил статистику.":       "Nobody has saved nickname or refreshed stats in this chat yet.",
+	"Используется сохранённая статистика, обновить свою можно командой /refresh.": "Saved stats are used, refresh yours with /refresh.",
+
+	// Errors
+	"Произошла неизвестная ошибка!":                                                   "Unknown error occurred!",
+	"Невозможно отправить сообщение!":                                                 "Unable to send the message!",
+	"Невозможно обновить сообщение!":                                                  "Unable to update the message!",
+	"Ошибка при работе с базой! Обратитесь к администратору бота.":                    "Database error! Contact bot administrator.",
+	"Ошибка при обращении к Wargaming API!":                                           "Wargaming API request error!",
+	"Ошибка при обращении к XVM!":                                                     "XVM request error!",
+	"Ошибка при обращении к KTTC!":                                                    "KTTC request error!",
+	"Ошибка при обращении к KTTC и XVM!":                                              "KTTC and XVM request error!",
+	"Никнейм не передан!":                                                             "Nickname isn't passed!",
+	"Игрок с данным никнеймом не найден!":                                             "Player with this nickname isn't found!",
+	"Один из игроков не найден!":                                                      "One of the players isn't found!",
+	"Игрок больше не сохранён!":                                                       "Player isn't saved anymore!",
+	"Сначала сохрани свой никнейм!":                                                   "Save your nickname first!",
+	"Неизвестный регион! Доступны: ru, eu, na, asia.":                                 "Unknown region! Available: ru, eu, na, asia.",
+	"Неизвестный язык! Доступны: ru, en.":                                             "Unknown language! Available: ru, en.",
+	"Неизвестный показатель! Доступны: wn8, winrate, damage, battles.":                "Unknown metric! Available: wn8, winrate, damage, battles.",
+	"Передай от двух до четырёх никнеймов, например: /compare nick1 nick2":            "Pass two to four nicknames, e.g. /compare nick1 nick2",
+	"Передай никнейм и название техники, например: /tank nickname Об. 140":            "Pass nickname and vehicle name, e.g. /tank nickname Obj. 140",
+	"Передай on или off, например: /autorefresh on":                                   "Pass on or off, e.g. /autorefresh on",
+	"Передай on с необязательным порогом в процентах или off, например: /notify on 3": "Pass on with optional threshold in percents or off, e.g. /notify on 3",
+	"Тег клана не передан!":                                                           "Clan tag isn't passed!",
+	"Клан с данным тегом не найден!":                                                  "Clan with this tag isn't found!",
+	"Команда работает только в группах!":                                              "The command works in groups only!",
+	"Техника с таким названием не найдена!":                                           "Vehicle with this name isn't found!",
+	"Игрок не играл на этой технике!":                                                 "Player hasn't played this vehicle!",
+	"Неверный период! Например: 7, 7d или 2w.":                                        "Wrong period! E.g. 7, 7d or 2w.",
+	"Пока не с чем сравнивать, обнови статистику позже: /refresh":                     "Nothing to compare with yet, refresh stats later: /refresh",
+	"Неизвестная кнопка!":                                                             "Unknown button!",
+	"Сообщение устарело, запроси статистику заново: /me":                              "The message is outdated, request stats again: /me",
+	"Слишком много запросов! Попробуй снова через %d мин.":                            "Too many requests! Try again in %d min.",
+	"Wargaming API временно недоступен, попробуй позже.":                              "Wargaming API is temporarily unavailable, try again later.",
+	"XVM временно недоступен, попробуй позже.":                                        "XVM is temporarily unavailable, try again later.",
+	"KTTC временно недоступен, попробуй позже.":                                       "KTTC is temporarily unavailable, try again later.",
+	"Источник данных временно недоступен, попробуй позже.":                            "Data source is temporarily unavailable, try again later.",
+	"График не найден!":                                                               "Chart isn't found!",
+}
@@ -0,0 +1,84 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Lang string
+
+const (
+	Russian Lang = "ru"
+	English Lang = "en"
+)
+
+// Default is the language messages are written in, their Russian text is the key in other bundles
+const Default = Russian
+
+var ErrUnknownLang = errors.New("unknown language")
+
+// bundles translate messages from default language, Russian doesn't need a bundle
+var bundles = map[Lang]map[string]string{
+	English: english,
+}
+
+// Parse parses language chosen by user
+func Parse(s string) (Lang, error) {
+	switch Lang(strings.ToLower(strings.TrimSpace(s))) {
+	case Russian:
+		return Russian, nil
+	case English:
+		return English, nil
+	}
+
+	return "", ErrUnknownLang
+}
+
+// Match picks language by Telegram client language code (IETF tag, e.g. en-US),
+// Russian is kept for neighbouring countries, everyone else gets English
+func Match(code string) Lang {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i != -1 {
+		code = code[:i]
+	}
+
+	switch code {
+	case "":
+		return Default
+	case "ru", "uk", "be", "kk":
+		return Russian
+	}
+
+	return English
+}
+
+// Sprintf translates format and formats it, message without translation is used as is
+func Sprintf(lang Lang, format string, args ...interface{}) string {
+	if s, ok := bundles[lang][format]; ok {
+		format = s
+	}
+
+	// Messages without arguments may contain percent signs
+	if len(args) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, args...)
+}
+
+type langKey struct{}
+
+func WithLang(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// FromContext returns language of the request, the default one if it isn't set
+func FromContext(ctx context.Context) Lang {
+	if lang, ok := ctx.Value(langKey{}).(Lang); ok {
+		return lang
+	}
+
+	return Default
+}
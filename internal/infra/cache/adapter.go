@@ -0,0 +1,336 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Adapter wraps upstream adapters with cache, wrapped adapters are returned as is if cache is disabled
+type Adapter interface {
+	Wargaming(next domain.Wargaming) domain.Wargaming
+	XVM(next domain.XVM) domain.XVM
+	KTTC(next domain.KTTC) domain.KTTC
+}
+
+// Backend stores encoded responses, missing and expired entries are reported with ok == false
+// or are absent in values of GetMany
+type Backend interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	GetMany(ctx context.Context, keys []string) (values map[string][]byte, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type adapter struct {
+	logger  *zap.Logger
+	config  *Config
+	backend Backend
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// errMissing is the error of call whose key is absent in bulk upstream response
+var errMissing = errors.New("missing in upstream response")
+
+// call is upstream request which is in flight, other requests of the same key wait for it
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+	// Request of the leader was cancelled, such error says nothing about upstream, so waiters fetch themselves
+	cancelled bool
+}
+
+func NewAdapter(logger *zap.Logger, config *Config, database domain.Database) (Adapter, error) {
+	a := &adapter{
+		logger: logger,
+		config: config,
+		calls:  make(map[string]*call),
+	}
+
+	switch config.Backend {
+	case backendNone:
+	case backendMemory:
+		a.backend = newMemoryBackend(config.Size)
+	case backendPostgres:
+		a.backend = newPostgresBackend(database)
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", config.Backend)
+	}
+
+	return a, nil
+}
+
+func (a *adapter) Wargaming(next domain.Wargaming) domain.Wargaming {
+	if a.backend == nil {
+		return next
+	}
+
+	return &wargaming{adapter: a, next: next}
+}
+
+func (a *adapter) XVM(next domain.XVM) domain.XVM {
+	if a.backend == nil {
+		return next
+	}
+
+	return &xvm{adapter: a, next: next}
+}
+
+func (a *adapter) KTTC(next domain.KTTC) domain.KTTC {
+	if a.backend == nil {
+		return next
+	}
+
+	return &kttc{adapter: a, next: next}
+}
+
+// load decodes cached value of the key into v or fetches it from upstream. Concurrent requests of the same key
+// share one upstream request, so they get its error too, unless the request was cancelled. Every caller gets
+// its own copy of the value.
+func (a *adapter) load(ctx context.Context, key string, ttl time.Duration, v interface{}, fetch func() (interface{}, error)) error {
+	if ttl > 0 && a.cached(ctx, key, v) {
+		return nil
+	}
+
+	for {
+		a.mu.Lock()
+		c, ok := a.calls[key]
+		if !ok {
+			c = &call{done: make(chan struct{})}
+			a.calls[key] = c
+		}
+		a.mu.Unlock()
+
+		if !ok {
+			a.lead(ctx, key, ttl, c, fetch)
+		} else {
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			// Another waiter or this one becomes the leader
+			if c.cancelled {
+				continue
+			}
+		}
+
+		if c.err != nil {
+			return c.err
+		}
+
+		return json.Unmarshal(c.value, v)
+	}
+}
+
+// lead fetches value of the call and wakes up its waiters, panic of fetch becomes the error of the call,
+// so waiters aren't stuck and the key isn't left in flight
+func (a *adapter) lead(ctx context.Context, key string, ttl time.Duration, c *call, fetch func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			domain.Logger(ctx, a.logger).Error("Panic while fetching value!", zap.String("key", key), zap.Any("panic", r))
+			c.err = fmt.Errorf("panic while fetching %s: %v", key, r)
+		}
+		c.cancelled = c.err != nil &&
+			(ctx.Err() != nil || errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded))
+
+		a.mu.Lock()
+		delete(a.calls, key)
+		a.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = a.fetch(ctx, key, ttl, fetch)
+}
+
+func (a *adapter) fetch(ctx context.Context, key string, ttl time.Duration, fetch func() (interface{}, error)) ([]byte, error) {
+	res, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		a.set(ctx, key, ttl, value)
+	}
+
+	return value, nil
+}
+
+// loadMany is load of many keys at once. Cached values are read with one backend request, missing ones are
+// fetched with one upstream request, and keys which are already in flight are waited for. Every value is passed
+// to decode, keys upstream knows nothing about are skipped.
+func (a *adapter) loadMany(
+	ctx context.Context,
+	keys []string,
+	ttl time.Duration,
+	decode func(key string, value []byte) error,
+	fetch func(keys []string) (map[string]interface{}, error),
+) error {
+	var missing []string
+	seen := make(map[string]bool, len(keys))
+	cached := a.cachedMany(ctx, keys, ttl)
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if value, ok := cached[key]; ok {
+			if err := decode(key, value); err == nil {
+				continue
+			}
+			domain.Logger(ctx, a.logger).Warn("Error decoding cached value, fetching it again!", zap.String("key", key))
+		}
+		missing = append(missing, key)
+	}
+
+	for len(missing) != 0 {
+		calls := make(map[string]*call, len(missing))
+		led := make(map[string]*call)
+
+		a.mu.Lock()
+		for _, key := range missing {
+			c, ok := a.calls[key]
+			if !ok {
+				c = &call{done: make(chan struct{})}
+				a.calls[key] = c
+				led[key] = c
+			}
+			calls[key] = c
+		}
+		a.mu.Unlock()
+
+		if len(led) != 0 {
+			a.leadMany(ctx, ttl, led, fetch)
+		}
+
+		missing = missing[:0]
+		for key, c := range calls {
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			// Leaders of other requests could be cancelled, then their keys are fetched again
+			_, own := led[key]
+			switch {
+			case c.cancelled && !own:
+				missing = append(missing, key)
+			case errors.Is(c.err, errMissing):
+			case c.err != nil:
+				return c.err
+			default:
+				if err := decode(key, c.value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// leadMany fetches values of the calls with one upstream request and wakes up their waiters
+func (a *adapter) leadMany(ctx context.Context, ttl time.Duration, calls map[string]*call, fetch func(keys []string) (map[string]interface{}, error)) {
+	keys := make([]string, 0, len(calls))
+	for key := range calls {
+		keys = append(keys, key)
+	}
+
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			domain.Logger(ctx, a.logger).Error("Panic while fetching values!", zap.Strings("keys", keys), zap.Any("panic", r))
+			err = fmt.Errorf("panic while fetching %d keys: %v", len(keys), r)
+		}
+		cancelled := err != nil &&
+			(ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+
+		a.mu.Lock()
+		for key, c := range calls {
+			if err != nil {
+				c.value, c.err, c.cancelled = nil, err, cancelled
+			}
+			delete(a.calls, key)
+		}
+		a.mu.Unlock()
+
+		for _, c := range calls {
+			close(c.done)
+		}
+	}()
+
+	var res map[string]interface{}
+	res, err = fetch(keys)
+	if err != nil {
+		return
+	}
+
+	for key, c := range calls {
+		v, ok := res[key]
+		if !ok {
+			c.err = errMissing
+			continue
+		}
+
+		if c.value, c.err = json.Marshal(v); c.err == nil && ttl > 0 {
+			a.set(ctx, key, ttl, c.value)
+		}
+	}
+}
+
+// cachedMany returns cached values of the keys, cache failures are treated as misses
+func (a *adapter) cachedMany(ctx context.Context, keys []string, ttl time.Duration) map[string][]byte {
+	if ttl <= 0 {
+		return nil
+	}
+
+	values, err := a.backend.GetMany(ctx, keys)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error getting cached values!", zap.Int("keys", len(keys)), zap.Error(err))
+		return nil
+	}
+
+	return values
+}
+
+// cached decodes cached value of the key into v, cache failures are treated as misses
+func (a *adapter) cached(ctx context.Context, key string, v interface{}) bool {
+	value, ok, err := a.backend.Get(ctx, key)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error getting cached value!", zap.String("key", key), zap.Error(err))
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	if err := json.Unmarshal(value, v); err != nil {
+		domain.Logger(ctx, a.logger).Warn("Error decoding cached value, fetching it again!", zap.String("key", key))
+		return false
+	}
+
+	return true
+}
+
+// set caches encoded value, cache failures only make the next request slower
+func (a *adapter) set(ctx context.Context, key string, ttl time.Duration, value []byte) {
+	if err := a.backend.Set(ctx, key, value, ttl); err != nil {
+		domain.Logger(ctx, a.logger).Error("Error caching value!", zap.String("key", key), zap.Error(err))
+	}
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestAdapter() *adapter {
+	return &adapter{
+		logger:  zap.NewNop(),
+		config:  &Config{},
+		backend: newMemoryBackend(10),
+		calls:   make(map[string]*call),
+	}
+}
+
+func TestLoadCoalesces(t *testing.T) {
+	a := newTestAdapter()
+	release := make(chan struct{})
+	var fetches int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var v int
+			err := a.load(context.Background(), "key", 0, &v, func() (interface{}, error) {
+				atomic.AddInt32(&fetches, 1)
+				<-release
+				return 42, nil
+			})
+			if err != nil || v != 42 {
+				t.Errorf("load() = %d, %v", v, err)
+			}
+		}()
+	}
+
+	// Let every caller reach the call before it's done
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestLoadPanic(t *testing.T) {
+	a := newTestAdapter()
+
+	var v int
+	err := a.load(context.Background(), "key", 0, &v, func() (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("expected error of panicked fetch")
+	}
+
+	// The key isn't left in flight, so the next request isn't stuck
+	err = a.load(context.Background(), "key", 0, &v, func() (interface{}, error) {
+		return 1, nil
+	})
+	if err != nil || v != 1 {
+		t.Errorf("load() after panic = %d, %v", v, err)
+	}
+}
+
+func TestLoadWaiterContext(t *testing.T) {
+	a := newTestAdapter()
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	go func() {
+		var v int
+		_ = a.load(context.Background(), "key", 0, &v, func() (interface{}, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var v int
+	err := a.load(ctx, "key", 0, &v, func() (interface{}, error) {
+		t.Error("waiter shouldn't fetch while leader is in flight")
+		return nil, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("load() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestLoadLeaderCancelled(t *testing.T) {
+	a := newTestAdapter()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		var v int
+		leaderDone <- a.load(ctx, "key", 0, &v, func() (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	}()
+	<-started
+
+	waiterDone := make(chan error)
+	var v int
+	go func() {
+		waiterDone <- a.load(context.Background(), "key", 0, &v, func() (interface{}, error) {
+			return 2, nil
+		})
+	}()
+
+	// Let the waiter reach the call before the leader is cancelled
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want %v", err, context.Canceled)
+	}
+	// Cancellation of the leader isn't shared, the waiter fetches by itself
+	if err := <-waiterDone; err != nil || v != 2 {
+		t.Errorf("waiter load() = %d, %v", v, err)
+	}
+}
+
+func TestLoadMany(t *testing.T) {
+	a := newTestAdapter()
+	ctx := context.Background()
+	if err := a.backend.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// Broken entry is fetched again
+	if err := a.backend.Set(ctx, "b", []byte("{"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var requested [][]string
+	got := map[string]int{}
+	err := a.loadMany(ctx, []string{"a", "b", "c", "c", "d"}, time.Minute, func(key string, value []byte) error {
+		var v int
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		got[key] = v
+		return nil
+	}, func(keys []string) (map[string]interface{}, error) {
+		sort.Strings(keys)
+		requested = append(requested, keys)
+		// Upstream knows nothing about d
+		return map[string]interface{}{"b": 2, "c": 3}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{"b", "c", "d"}}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %v, want %v", requested, want)
+	}
+	if want := map[string]int{"a": 1, "b": 2, "c": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMany() = %v, want %v", got, want)
+	}
+	if value, ok, _ := a.backend.Get(ctx, "c"); !ok || string(value) != "3" {
+		t.Errorf("fetched value isn't cached: %q", value)
+	}
+}
+
+func TestLoadManyCoalesces(t *testing.T) {
+	a := newTestAdapter()
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	// Single load of one of the keys is in flight already
+	go func() {
+		var v int
+		_ = a.load(context.Background(), "a", 0, &v, func() (interface{}, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+	}()
+	<-started
+
+	var requested []string
+	got := map[string]int{}
+	done := make(chan error)
+	go func() {
+		done <- a.loadMany(context.Background(), []string{"a", "b"}, 0, func(key string, value []byte) error {
+			var v int
+			err := json.Unmarshal(value, &v)
+			got[key] = v
+			return err
+		}, func(keys []string) (map[string]interface{}, error) {
+			requested = keys
+			return map[string]interface{}{"b": 2}, nil
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(requested, []string{"b"}) {
+		t.Errorf("requested %v, want [b]", requested)
+	}
+	if want := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMany() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadManyError(t *testing.T) {
+	a := newTestAdapter()
+	fail := errors.New("upstream")
+
+	err := a.loadMany(context.Background(), []string{"a"}, time.Minute, func(key string, value []byte) error {
+		return nil
+	}, func(keys []string) (map[string]interface{}, error) {
+		return nil, fail
+	})
+	if err != fail {
+		t.Errorf("loadMany() error = %v, want %v", err, fail)
+	}
+
+	// Failed keys aren't left in flight
+	if len(a.calls) != 0 {
+		t.Errorf("%d calls are left in flight", len(a.calls))
+	}
+}
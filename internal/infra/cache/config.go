@@ -0,0 +1,18 @@
+package cache
+
+import "time"
+
+const (
+	backendNone     = "none"
+	backendMemory   = "memory"
+	backendPostgres = "postgres"
+)
+
+type Config struct {
+	Backend      string        `long:"backend" env:"BACKEND" description:"Storage of upstream responses cache" choice:"none" choice:"memory" choice:"postgres" default:"memory"`
+	Size         int           `long:"size" env:"SIZE" description:"Maximum entries count of in-memory cache, least recently used ones are evicted" default:"10000"`
+	PlayerTTL    time.Duration `long:"player-ttl" env:"PLAYER_TTL" description:"How long nickname to account ID resolution is cached" default:"168h"`
+	WargamingTTL time.Duration `long:"wargaming-ttl" env:"WARGAMING_TTL" description:"How long Wargaming API responses are cached, zero disables caching" default:"10m"`
+	XVMTTL       time.Duration `long:"xvm-ttl" env:"XVM_TTL" description:"How long XVM stats are cached, zero disables caching" default:"5m"`
+	KTTCTTL      time.Duration `long:"kttc-ttl" env:"KTTC_TTL" description:"How long KTTC stats are cached, zero disables caching" default:"10m"`
+}
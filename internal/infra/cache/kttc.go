@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/L11R/wotbot/internal/domain"
+)
+
+type kttc struct {
+	*adapter
+	next domain.KTTC
+}
+
+func (k *kttc) GetStats(ctx context.Context, region domain.Region, accountID int) ([]*domain.KTTCWindow, error) {
+	var ww []*domain.KTTCWindow
+	if err := k.load(ctx, fmt.Sprintf("kttc:stats:%s:%d", region, accountID), k.config.KTTCTTL, &ww, func() (interface{}, error) {
+		return k.next.GetStats(ctx, region, accountID)
+	}); err != nil {
+		return nil, err
+	}
+
+	return ww, nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryBackend is LRU cache, the least recently used entry is evicted when it's full
+type memoryBackend struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// Front is the most recently used entry
+	order *list.List
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func newMemoryBackend(size int) *memoryBackend {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &memoryBackend{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (b *memoryBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	value, ok := b.get(key)
+	return value, ok, nil
+}
+
+func (b *memoryBackend) GetMany(_ context.Context, keys []string) (map[string][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if value, ok := b.get(key); ok {
+			values[key] = value
+		}
+	}
+
+	return values, nil
+}
+
+// get returns value of the entry which isn't expired yet, mu has to be held
+func (b *memoryBackend) get(key string) ([]byte, bool) {
+	el, ok := b.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expiresAt) {
+		b.order.Remove(el)
+		delete(b.entries, key)
+		return nil, false
+	}
+
+	b.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (b *memoryBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := &memoryEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if el, ok := b.entries[key]; ok {
+		el.Value = e
+		b.order.MoveToFront(el)
+		return nil
+	}
+
+	b.entries[key] = b.order.PushFront(e)
+	for b.order.Len() > b.size {
+		el := b.order.Back()
+		b.order.Remove(el)
+		delete(b.entries, el.Value.(*memoryEntry).key)
+	}
+
+	return nil
+}
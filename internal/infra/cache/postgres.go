@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/L11R/wotbot/internal/domain"
+)
+
+// Expired entries are deleted once in a while, reads skip them anyway
+const postgresCleanupInterval = time.Hour
+
+// postgresBackend keeps cache in database, so it's shared by bot instances and survives restarts
+type postgresBackend struct {
+	database domain.Database
+
+	mu      sync.Mutex
+	cleaned time.Time
+}
+
+func newPostgresBackend(database domain.Database) *postgresBackend {
+	return &postgresBackend{
+		database: database,
+		cleaned:  time.Now(),
+	}
+}
+
+func (b *postgresBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := b.database.GetCacheEntry(ctx, key)
+	if err != nil {
+		if errors.Is(err, domain.ErrCacheEntryNotFound) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+func (b *postgresBackend) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return b.database.GetCacheEntries(ctx, keys)
+}
+
+func (b *postgresBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := b.database.SetCacheEntry(ctx, key, value, ttl); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	cleanup := time.Since(b.cleaned) >= postgresCleanupInterval
+	if cleanup {
+		b.cleaned = time.Now()
+	}
+	b.mu.Unlock()
+
+	if cleanup {
+		return b.database.DeleteExpiredCacheEntries(ctx)
+	}
+
+	return nil
+}
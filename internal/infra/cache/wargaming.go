@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/L11R/wotbot/internal/domain"
+)
+
+type wargaming struct {
+	*adapter
+	next domain.Wargaming
+}
+
+// FindPlayer result is cached for a long time, nickname rarely starts pointing to another account
+func (w *wargaming) FindPlayer(ctx context.Context, region domain.Region, nickname string) (string, int, error) {
+	var p domain.Player
+	if err := w.load(ctx, fmt.Sprintf("wargaming:player:%s:%s", region, strings.ToLower(nickname)), w.config.PlayerTTL, &p, func() (interface{}, error) {
+		nickname, accountID, err := w.next.FindPlayer(ctx, region, nickname)
+		return &domain.Player{Nickname: nickname, AccountID: accountID}, err
+	}); err != nil {
+		return "", 0, err
+	}
+
+	return p.Nickname, p.AccountID, nil
+}
+
+func (w *wargaming) SearchPlayers(ctx context.Context, region domain.Region, nickname string, limit int) ([]*domain.Player, error) {
+	var pp []*domain.Player
+	if err := w.load(ctx, fmt.Sprintf("wargaming:search:%s:%d:%s", region, limit, strings.ToLower(nickname)), w.config.WargamingTTL, &pp, func() (interface{}, error) {
+		return w.next.SearchPlayers(ctx, region, nickname, limit)
+	}); err != nil {
+		return nil, err
+	}
+
+	return pp, nil
+}
+
+func (w *wargaming) GetAccountInfo(ctx context.Context, region domain.Region, accountID int) (*domain.AccountInfo, error) {
+	var info domain.AccountInfo
+	if err := w.load(ctx, accountKey(region, accountID), w.config.WargamingTTL, &info, func() (interface{}, error) {
+		return w.next.GetAccountInfo(ctx, region, accountID)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// GetVehicles isn't cached here, service keeps vehicle catalog in database by itself
+func (w *wargaming) GetVehicles(ctx context.Context, region domain.Region) ([]*domain.Vehicle, error) {
+	return w.next.GetVehicles(ctx, region)
+}
+
+func (w *wargaming) GetTankStats(ctx context.Context, region domain.Region, accountID int, tankID int) (*domain.TankStats, error) {
+	var ts domain.TankStats
+	if err := w.load(ctx, fmt.Sprintf("wargaming:tank:%s:%d:%d", region, accountID, tankID), w.config.WargamingTTL, &ts, func() (interface{}, error) {
+		return w.next.GetTankStats(ctx, region, accountID, tankID)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &ts, nil
+}
+
+func (w *wargaming) GetTanksStats(ctx context.Context, region domain.Region, accountID int) ([]*domain.TankStats, error) {
+	var tss []*domain.TankStats
+	if err := w.load(ctx, tanksKey(region, accountID), w.config.WargamingTTL, &tss, func() (interface{}, error) {
+		return w.next.GetTanksStats(ctx, region, accountID)
+	}); err != nil {
+		return nil, err
+	}
+
+	return tss, nil
+}
+
+func (w *wargaming) FindClan(ctx context.Context, region domain.Region, tag string) (int, error) {
+	var clanID int
+	if err := w.load(ctx, fmt.Sprintf("wargaming:clan_tag:%s:%s", region, strings.ToUpper(tag)), w.config.WargamingTTL, &clanID, func() (interface{}, error) {
+		return w.next.FindClan(ctx, region, tag)
+	}); err != nil {
+		return 0, err
+	}
+
+	return clanID, nil
+}
+
+func (w *wargaming) GetClanInfo(ctx context.Context, region domain.Region, clanID int) (*domain.Clan, error) {
+	var clan domain.Clan
+	if err := w.load(ctx, fmt.Sprintf("wargaming:clan:%s:%d", region, clanID), w.config.WargamingTTL, &clan, func() (interface{}, error) {
+		return w.next.GetClanInfo(ctx, region, clanID)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &clan, nil
+}
+
+// GetAccountsInfo shares cache entries with GetAccountInfo, only missing accounts are requested
+func (w *wargaming) GetAccountsInfo(ctx context.Context, region domain.Region, accountIDs []int) (map[int]*domain.AccountInfo, error) {
+	keys, ids := accountKeys(accountIDs, func(accountID int) string { return accountKey(region, accountID) })
+
+	infos := make(map[int]*domain.AccountInfo, len(accountIDs))
+	if err := w.loadMany(ctx, keys, w.config.WargamingTTL, func(key string, value []byte) error {
+		var info domain.AccountInfo
+		if err := json.Unmarshal(value, &info); err != nil {
+			return err
+		}
+
+		infos[ids[key]] = &info
+		return nil
+	}, func(keys []string) (map[string]interface{}, error) {
+		fresh, err := w.next.GetAccountsInfo(ctx, region, keysAccounts(keys, ids))
+		if err != nil {
+			return nil, err
+		}
+
+		res := make(map[string]interface{}, len(fresh))
+		for accountID, info := range fresh {
+			res[accountKey(region, accountID)] = info
+		}
+		return res, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+// GetAccountsTanksStats shares cache entries with GetTanksStats, only missing accounts are requested
+func (w *wargaming) GetAccountsTanksStats(ctx context.Context, region domain.Region, accountIDs []int) (map[int][]*domain.TankStats, error) {
+	keys, ids := accountKeys(accountIDs, func(accountID int) string { return tanksKey(region, accountID) })
+
+	stats := make(map[int][]*domain.TankStats, len(accountIDs))
+	if err := w.loadMany(ctx, keys, w.config.WargamingTTL, func(key string, value []byte) error {
+		var tss []*domain.TankStats
+		if err := json.Unmarshal(value, &tss); err != nil {
+			return err
+		}
+
+		stats[ids[key]] = tss
+		return nil
+	}, func(keys []string) (map[string]interface{}, error) {
+		fresh, err := w.next.GetAccountsTanksStats(ctx, region, keysAccounts(keys, ids))
+		if err != nil {
+			return nil, err
+		}
+
+		res := make(map[string]interface{}, len(fresh))
+		for accountID, tss := range fresh {
+			res[tanksKey(region, accountID)] = tss
+		}
+		return res, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// accountKeys returns cache keys of the accounts and account ID of every key
+func accountKeys(accountIDs []int, key func(accountID int) string) ([]string, map[string]int) {
+	keys := make([]string, 0, len(accountIDs))
+	ids := make(map[string]int, len(accountIDs))
+	for _, accountID := range accountIDs {
+		k := key(accountID)
+		keys = append(keys, k)
+		ids[k] = accountID
+	}
+
+	return keys, ids
+}
+
+func keysAccounts(keys []string, ids map[string]int) []int {
+	accountIDs := make([]int, 0, len(keys))
+	for _, key := range keys {
+		accountIDs = append(accountIDs, ids[key])
+	}
+
+	return accountIDs
+}
+
+func accountKey(region domain.Region, accountID int) string {
+	return fmt.Sprintf("wargaming:account:%s:%d", region, accountID)
+}
+
+func tanksKey(region domain.Region, accountID int) string {
+	return fmt.Sprintf("wargaming:tanks:%s:%d", region, accountID)
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/L11R/wotbot/internal/domain"
+)
+
+type xvm struct {
+	*adapter
+	next domain.XVM
+}
+
+// GetStats with trend is requested to save fresh snapshot (/save, /refresh, scheduler), so it always goes to XVM
+func (x *xvm) GetStats(ctx context.Context, region domain.Region, accountID int, withTrend bool) ([]*domain.XVMStat, error) {
+	if withTrend {
+		return x.next.GetStats(ctx, region, accountID, withTrend)
+	}
+
+	var ss []*domain.XVMStat
+	if err := x.load(ctx, fmt.Sprintf("xvm:stats:%s:%d", region, accountID), x.config.XVMTTL, &ss, func() (interface{}, error) {
+		return x.next.GetStats(ctx, region, accountID, false)
+	}); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
@@ -0,0 +1,382 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+type Type string
+
+const (
+	Line Type = "line"
+	Bar  Type = "bar"
+)
+
+type Dataset struct {
+	Label string
+	// NaN marks a missing point, it's left as a gap
+	Values []float64
+}
+
+type Chart struct {
+	Type     Type
+	Title    string
+	Labels   []string
+	Datasets []*Dataset
+}
+
+const (
+	marginTop    = 48
+	marginRight  = 24
+	marginBottom = 56
+	marginLeft   = 72
+	legendHeight = 20
+	// Plot area smaller than this can't fit even axis labels
+	minPlotSize = 40
+	yTicks      = 5
+)
+
+var (
+	background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	foreground = color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xff}
+	gridColor  = color.RGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 0xff}
+	// Same palette XVM uses for its charts
+	palette = []color.RGBA{
+		{R: 0x36, G: 0xa2, B: 0xeb, A: 0xff},
+		{R: 0xff, G: 0x63, B: 0x84, A: 0xff},
+		{R: 0x4b, G: 0xc0, B: 0xc0, A: 0xff},
+		{R: 0xff, G: 0x9f, B: 0x40, A: 0xff},
+		{R: 0x99, G: 0x66, B: 0xff, A: 0xff},
+		{R: 0xff, G: 0xcd, B: 0x56, A: 0xff},
+	}
+)
+
+var (
+	// Font faces are not safe for concurrent use, so only one chart is rendered at a time
+	mu         sync.Mutex
+	facesOnce  sync.Once
+	titleFace  font.Face
+	labelFace  font.Face
+	facesError error
+)
+
+func loadFaces() {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		facesError = err
+		return
+	}
+
+	titleFace, facesError = opentype.NewFace(f, &opentype.FaceOptions{Size: 16, DPI: 72, Hinting: font.HintingFull})
+	if facesError != nil {
+		return
+	}
+
+	labelFace, facesError = opentype.NewFace(f, &opentype.FaceOptions{Size: 11, DPI: 72, Hinting: font.HintingFull})
+}
+
+// Render draws the chart and encodes it as PNG image
+func Render(c *Chart, width, height int) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	facesOnce.Do(loadFaces)
+	if facesError != nil {
+		return nil, facesError
+	}
+
+	if len(c.Labels) == 0 || len(c.Datasets) == 0 {
+		return nil, fmt.Errorf("chart has no data")
+	}
+
+	// Checked before building rectangle, image.Rect swaps inverted corners
+	plotHeight := height - marginTop - marginBottom
+	if len(c.Datasets) > 1 {
+		plotHeight -= legendHeight
+	}
+	if width-marginLeft-marginRight < minPlotSize || plotHeight < minPlotSize {
+		return nil, fmt.Errorf("chart size %dx%d is too small", width, height)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+
+	if c.Title != "" {
+		drawText(img, titleFace, c.Title, (width-textWidth(titleFace, c.Title))/2, 28, foreground)
+	}
+
+	plot := image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom)
+	if len(c.Datasets) > 1 {
+		plot.Max.Y -= legendHeight
+		drawLegend(img, c.Datasets, height-24)
+	}
+
+	min, max := bounds(c)
+	drawGrid(img, plot, min, max)
+
+	switch c.Type {
+	case Bar:
+		drawBars(img, plot, c, min, max)
+	default:
+		drawLines(img, plot, c, min, max)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// bounds returns rounded Y-axis limits covering every value of the chart
+func bounds(c *Chart) (float64, float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, ds := range c.Datasets {
+		for _, v := range ds.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+	}
+
+	if math.IsInf(min, 0) || math.IsInf(max, 0) {
+		return 0, 1
+	}
+
+	// Bars always grow from zero
+	if c.Type == Bar && min > 0 {
+		min = 0
+	}
+
+	if min == max {
+		min, max = min-1, max+1
+	}
+
+	step := niceStep((max - min) / yTicks)
+	return math.Floor(min/step) * step, math.Ceil(max/step) * step
+}
+
+func niceStep(raw float64) float64 {
+	exp := math.Pow(10, math.Floor(math.Log10(raw)))
+	switch f := raw / exp; {
+	case f <= 1:
+		return exp
+	case f <= 2:
+		return 2 * exp
+	case f <= 5:
+		return 5 * exp
+	default:
+		return 10 * exp
+	}
+}
+
+func scaleY(plot image.Rectangle, min, max, v float64) int {
+	return plot.Max.Y - int(math.Round((v-min)/(max-min)*float64(plot.Dy())))
+}
+
+func drawGrid(img *image.RGBA, plot image.Rectangle, min, max float64) {
+	for i := 0; i <= yTicks; i++ {
+		v := min + (max-min)*float64(i)/yTicks
+		y := scaleY(plot, min, max, v)
+		hline(img, plot.Min.X, plot.Max.X, y, gridColor)
+
+		label := formatValue(v)
+		drawText(img, labelFace, label, plot.Min.X-8-textWidth(labelFace, label), y+4, foreground)
+	}
+
+	hline(img, plot.Min.X, plot.Max.X, plot.Max.Y, foreground)
+	vline(img, plot.Min.X, plot.Min.Y, plot.Max.Y, foreground)
+}
+
+// drawXLabels prints category labels, skipping some of them if they would overlap
+func drawXLabels(img *image.RGBA, plot image.Rectangle, labels []string, x func(i int) int) {
+	widest := 0
+	for _, l := range labels {
+		if w := textWidth(labelFace, l); w > widest {
+			widest = w
+		}
+	}
+
+	every := 1
+	if slot := plot.Dx() / len(labels); slot > 0 && widest+8 > slot {
+		every = (widest+8)/slot + 1
+	}
+
+	for i, l := range labels {
+		if i%every != 0 {
+			continue
+		}
+		drawText(img, labelFace, l, x(i)-textWidth(labelFace, l)/2, plot.Max.Y+18, foreground)
+	}
+}
+
+func drawLines(img *image.RGBA, plot image.Rectangle, c *Chart, min, max float64) {
+	// Keep points away from the axis
+	left, width := plot.Min.X+16, plot.Dx()-32
+	x := func(i int) int {
+		if len(c.Labels) == 1 {
+			return left + width/2
+		}
+		return left + i*width/(len(c.Labels)-1)
+	}
+
+	for n, ds := range c.Datasets {
+		col := palette[n%len(palette)]
+		for i := range ds.Values {
+			if i >= len(c.Labels) {
+				break
+			}
+			if math.IsNaN(ds.Values[i]) {
+				continue
+			}
+
+			x1, y1 := x(i), scaleY(plot, min, max, ds.Values[i])
+			fillRect(img, image.Rect(x1-2, y1-2, x1+3, y1+3), col)
+			// Lines aren't drawn across gaps
+			if i > 0 && !math.IsNaN(ds.Values[i-1]) {
+				x0, y0 := x(i-1), scaleY(plot, min, max, ds.Values[i-1])
+				line(img, x0, y0, x1, y1, col)
+				line(img, x0, y0+1, x1, y1+1, col)
+			}
+		}
+	}
+
+	drawXLabels(img, plot, c.Labels, x)
+}
+
+func drawBars(img *image.RGBA, plot image.Rectangle, c *Chart, min, max float64) {
+	slot := plot.Dx() / len(c.Labels)
+	barWidth := slot * 2 / 3 / len(c.Datasets)
+	if barWidth < 1 {
+		barWidth = 1
+	}
+
+	x := func(i int) int {
+		return plot.Min.X + i*slot + slot/2
+	}
+
+	zero := scaleY(plot, min, max, math.Max(min, 0))
+	for n, ds := range c.Datasets {
+		col := palette[n%len(palette)]
+		for i, v := range ds.Values {
+			if i >= len(c.Labels) {
+				break
+			}
+			if math.IsNaN(v) {
+				continue
+			}
+
+			left := x(i) - barWidth*len(c.Datasets)/2 + n*barWidth
+			top, bottom := scaleY(plot, min, max, v), zero
+			if top > bottom {
+				top, bottom = bottom, top
+			}
+			fillRect(img, image.Rect(left, top, left+barWidth-1, bottom), col)
+
+			label := formatValue(v)
+			drawText(img, labelFace, label, left+barWidth/2-textWidth(labelFace, label)/2, top-4, foreground)
+		}
+	}
+
+	drawXLabels(img, plot, c.Labels, x)
+}
+
+func drawLegend(img *image.RGBA, datasets []*Dataset, y int) {
+	x := marginLeft
+	for n, ds := range datasets {
+		fillRect(img, image.Rect(x, y-9, x+10, y+1), palette[n%len(palette)])
+		drawText(img, labelFace, ds.Label, x+14, y, foreground)
+		x += textWidth(labelFace, ds.Label) + 32
+	}
+}
+
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	if math.Abs(v) >= 100 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+func textWidth(face font.Face, s string) int {
+	return font.MeasureString(face, s).Round()
+}
+
+func drawText(img *image.RGBA, face font.Face, s string, x, y int, col color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, col color.Color) {
+	draw.Draw(img, r, &image.Uniform{C: col}, image.Point{}, draw.Src)
+}
+
+func hline(img *image.RGBA, x0, x1, y int, col color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, col)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, col color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, col)
+	}
+}
+
+// line draws a straight line using Bresenham's algorithm
+func line(img *image.RGBA, x0, y0, x1, y1 int, col color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+	for {
+		img.Set(x0, y0, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
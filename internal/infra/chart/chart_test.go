@@ -0,0 +1,99 @@
+package chart
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func testChart(datasets int) *Chart {
+	c := &Chart{Type: Line, Title: "Winrate", Labels: []string{"a", "b", "c"}}
+	for i := 0; i < datasets; i++ {
+		c.Datasets = append(c.Datasets, &Dataset{Label: "ds", Values: []float64{1, 2, 3}})
+	}
+
+	return c
+}
+
+func TestRender(t *testing.T) {
+	for _, typ := range []Type{Line, Bar} {
+		c := testChart(2)
+		c.Type = typ
+
+		b, err := Render(c, 320, 240)
+		if err != nil {
+			t.Fatalf("Render(%s) error: %v", typ, err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("Render(%s) returned invalid PNG: %v", typ, err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != 320 || bounds.Dy() != 240 {
+			t.Errorf("Render(%s) size = %v, want 320x240", typ, bounds.Size())
+		}
+	}
+}
+
+func TestRenderGaps(t *testing.T) {
+	for _, typ := range []Type{Line, Bar} {
+		c := testChart(1)
+		c.Type = typ
+		c.Datasets[0].Values = []float64{math.NaN(), 2, math.NaN()}
+
+		if _, err := Render(c, 320, 240); err != nil {
+			t.Errorf("Render(%s) error: %v", typ, err)
+		}
+	}
+}
+
+func TestBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      Type
+		values   []float64
+		min, max float64
+	}{
+		{"line", Line, []float64{12, 47}, 10, 50},
+		{"bars grow from zero", Bar, []float64{12, 47}, 0, 50},
+		{"gaps are skipped", Line, []float64{math.NaN(), 12, math.NaN(), 47}, 10, 50},
+		{"only gaps", Line, []float64{math.NaN()}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Chart{Type: tt.typ, Datasets: []*Dataset{{Values: tt.values}}}
+			if min, max := bounds(c); min != tt.min || max != tt.max {
+				t.Errorf("bounds() = %v, %v, want %v, %v", min, max, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRenderTooSmall(t *testing.T) {
+	tests := []struct {
+		name          string
+		datasets      int
+		width, height int
+	}{
+		{"narrower than margins", 1, marginLeft + marginRight, 240},
+		{"lower than margins", 1, 320, marginTop + marginBottom},
+		{"no room for legend", 2, 320, marginTop + marginBottom + minPlotSize},
+		{"negative", 1, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Render(testChart(tt.datasets), tt.width, tt.height); err == nil {
+				t.Errorf("Render() of %dx%d succeeded, want error", tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestRenderNoData(t *testing.T) {
+	if _, err := Render(&Chart{Labels: []string{"a"}}, 320, 240); err == nil {
+		t.Error("Render() of chart without datasets succeeded, want error")
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/infra/metrics"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -55,32 +57,36 @@ func NewAdapter(logger *zap.Logger, config *Config) (domain.Database, error) {
 	return a, nil
 }
 
-func (a *adapter) GetUserByTelegramID(telegramID int) (*domain.User, error) {
-	row := a.db.QueryRowx(`SELECT id, telegram_id, nickname, wargaming_id, created_at, updated_at FROM users WHERE telegram_id = $1`, telegramID)
-	if row.Err() != nil {
-		if errors.Is(row.Err(), sql.ErrNoRows) {
-			return nil, domain.ErrUserNotFound
-		}
+func (a *adapter) GetUserByTelegramID(ctx context.Context, telegramID int) (*domain.User, error) {
+	defer metrics.ObserveQuery("GetUserByTelegramID", time.Now())
 
-		a.logger.Error("Error getting user!", zap.Error(row.Err()))
+	row := a.db.QueryRowxContext(ctx, `SELECT id, telegram_id, nickname, wargaming_id, wargaming_region, region, auto_refresh, language, language_code, refreshed_at, created_at, updated_at FROM users WHERE telegram_id = $1`, telegramID)
+	if row.Err() != nil {
+		domain.Logger(ctx, a.logger).Error("Error getting user!", zap.Error(row.Err()))
 		return nil, domain.ErrInternalDatabase
 	}
 
 	var res domain.User
 	if err := row.StructScan(&res); err != nil {
-		a.logger.Error("Error scanning result!", zap.Error(err))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+
+		domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 
 	return &res, nil
 }
 
-func (a *adapter) UpsertUser(user *domain.User) (*domain.User, error) {
-	rows, err := a.db.NamedQuery(`INSERT INTO users (telegram_id, nickname, wargaming_id)
-VALUES (:telegram_id, :nickname, :wargaming_id)
-ON CONFLICT (telegram_id) DO UPDATE SET nickname = COALESCE(EXCLUDED.nickname, users.nickname), wargaming_id = COALESCE(EXCLUDED.wargaming_id, users.wargaming_id) RETURNING id, telegram_id, nickname, wargaming_id, created_at, updated_at;`, user)
+func (a *adapter) UpsertUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+	defer metrics.ObserveQuery("UpsertUser", time.Now())
+
+	rows, err := a.db.NamedQueryContext(ctx, `INSERT INTO users (telegram_id, nickname, wargaming_id, wargaming_region, region, auto_refresh, language, language_code, refreshed_at)
+VALUES (:telegram_id, :nickname, :wargaming_id, :wargaming_region, :region, :auto_refresh, :language, :language_code, :refreshed_at)
+ON CONFLICT (telegram_id) DO UPDATE SET nickname = COALESCE(EXCLUDED.nickname, users.nickname), wargaming_id = COALESCE(EXCLUDED.wargaming_id, users.wargaming_id), wargaming_region = COALESCE(EXCLUDED.wargaming_region, users.wargaming_region), region = COALESCE(EXCLUDED.region, users.region), auto_refresh = COALESCE(EXCLUDED.auto_refresh, users.auto_refresh), language = COALESCE(EXCLUDED.language, users.language), language_code = COALESCE(EXCLUDED.language_code, users.language_code), refreshed_at = COALESCE(EXCLUDED.refreshed_at, users.refreshed_at) RETURNING id, telegram_id, nickname, wargaming_id, wargaming_region, region, auto_refresh, language, language_code, refreshed_at, created_at, updated_at;`, user)
 	if err != nil {
-		a.logger.Error("Error upserting user!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error upserting user!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 	//noinspection GoUnhandledErrorResult
@@ -89,31 +95,87 @@ ON CONFLICT (telegram_id) DO UPDATE SET nickname = COALESCE(EXCLUDED.nickname, u
 	for rows.Next() {
 		var res domain.User
 		if err := rows.StructScan(&res); err != nil {
-			a.logger.Error("Error scanning result!", zap.Error(err))
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
 			return nil, domain.ErrInternalDatabase
 		}
 
 		return &res, nil
 	}
 
-	a.logger.Error("There is no results to scan!")
+	domain.Logger(ctx, a.logger).Error("There is no results to scan!")
 	return nil, domain.ErrInternalDatabase
 }
 
-func (a *adapter) GetStatsByUserID(userID int) ([]*domain.XVMStat, error) {
-	rows, err := a.db.Queryx(`SELECT * FROM stats WHERE user_id = $1`, userID)
+func (a *adapter) GetAutoRefreshUsers(ctx context.Context) ([]*domain.User, error) {
+	defer metrics.ObserveQuery("GetAutoRefreshUsers", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT id, telegram_id, nickname, wargaming_id, wargaming_region, region, auto_refresh, language, language_code, refreshed_at, created_at, updated_at FROM users WHERE auto_refresh AND wargaming_id IS NOT NULL ORDER BY id`)
 	if err != nil {
-		a.logger.Error("Error selecting stats!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error selecting auto refresh users!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 	//noinspection GoUnhandledErrorResult
 	defer rows.Close()
 
-	results := make([]*domain.XVMStat, 0)
+	results := make([]*domain.User, 0)
 	for rows.Next() {
-		var res domain.XVMStat
+		var res domain.User
+		if err := rows.StructScan(&res); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, nil
+}
+
+// UpsertChatMember links known user to the chat, unknown users are skipped
+func (a *adapter) UpsertChatMember(ctx context.Context, chatID int64, telegramID int) error {
+	defer metrics.ObserveQuery("UpsertChatMember", time.Now())
+
+	_, err := a.db.ExecContext(ctx, `INSERT INTO chat_members (chat_id, user_id)
+SELECT $1, id FROM users WHERE telegram_id = $2
+ON CONFLICT (chat_id, user_id) DO UPDATE SET updated_at = now();`, chatID, telegramID)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error upserting chat member!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) DeleteChatMember(ctx context.Context, chatID int64, telegramID int) error {
+	defer metrics.ObserveQuery("DeleteChatMember", time.Now())
+
+	_, err := a.db.ExecContext(ctx, `DELETE FROM chat_members WHERE chat_id = $1 AND user_id = (SELECT id FROM users WHERE telegram_id = $2)`, chatID, telegramID)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error deleting chat member!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) GetChatUsers(ctx context.Context, chatID int64) ([]*domain.User, error) {
+	defer metrics.ObserveQuery("GetChatUsers", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT u.id, u.telegram_id, u.nickname, u.wargaming_id, u.wargaming_region, u.region, u.auto_refresh, u.language, u.refreshed_at, u.created_at, u.updated_at
+FROM users u JOIN chat_members cm ON cm.user_id = u.id
+WHERE cm.chat_id = $1 AND u.wargaming_id IS NOT NULL ORDER BY u.id`, chatID)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error selecting chat users!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	results := make([]*domain.User, 0)
+	for rows.Next() {
+		var res domain.User
 		if err := rows.StructScan(&res); err != nil {
-			a.logger.Error("Error scanning result!", zap.Error(err))
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
 			return nil, domain.ErrInternalDatabase
 		}
 
@@ -123,50 +185,458 @@ func (a *adapter) GetStatsByUserID(userID int) ([]*domain.XVMStat, error) {
 	return results, nil
 }
 
-func (a *adapter) UpdateStatsByUserID(userID int, stats []*domain.XVMStat) ([]*domain.XVMStat, error) {
-	tx, err := a.db.BeginTxx(context.Background(), nil)
+func (a *adapter) GetStatsByUserID(ctx context.Context, userID int) ([]*domain.XVMStat, error) {
+	defer metrics.ObserveQuery("GetStatsByUserID", time.Now())
+
+	return a.selectStats(
+		ctx,
+		`SELECT * FROM stats WHERE snapshot_id = (SELECT id FROM snapshots WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1) ORDER BY id`,
+		userID,
+	)
+}
+
+// GetLatestStatsByUserIDs returns stats of the latest snapshot of every user at once, charts aren't selected
+func (a *adapter) GetLatestStatsByUserIDs(ctx context.Context, userIDs []int) ([]*domain.XVMStat, error) {
+	defer metrics.ObserveQuery("GetLatestStatsByUserIDs", time.Now())
+
+	return a.selectStats(
+		ctx,
+		`SELECT st.id, st.user_id, st.snapshot_id, st.type, st.name, st.value, st.html_id, st.created_at
+FROM stats st
+JOIN (SELECT DISTINCT ON (user_id) id FROM snapshots WHERE user_id = ANY($1) ORDER BY user_id, created_at DESC, id DESC) sn
+ON sn.id = st.snapshot_id
+ORDER BY st.id`,
+		pq.Array(userIDs),
+	)
+}
+
+func (a *adapter) CreateSnapshot(ctx context.Context, userID int, stats []*domain.XVMStat) (*domain.Snapshot, error) {
+	defer metrics.ObserveQuery("CreateSnapshot", time.Now())
+
+	tx, err := a.db.BeginTxx(ctx, nil)
 	if err != nil {
-		a.logger.Error("Error beginning database transaction!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error beginning database transaction!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 
 	defer func(err *error) {
 		if err != nil && *err != nil {
 			if err := tx.Rollback(); err != nil {
-				a.logger.Error("Error while rollback transaction!", zap.Error(err))
+				domain.Logger(ctx, a.logger).Error("Error while rollback transaction!", zap.Error(err))
 			}
 		}
 	}(&err)
 
-	_, err = tx.Exec(`DELETE FROM stats WHERE user_id = $1`, userID)
+	var snapshot domain.Snapshot
+	err = tx.QueryRowxContext(ctx, `INSERT INTO snapshots (user_id) VALUES ($1) RETURNING id, user_id, created_at`, userID).StructScan(&snapshot)
 	if err != nil {
-		a.logger.Error("Error deleting old stats!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error inserting new snapshot!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 
-	// Set user_id
+	// Set user_id and snapshot_id
 	for i := range stats {
 		stats[i].UserID = userID
+		stats[i].SnapshotID = snapshot.ID
 	}
 
-	_, err = tx.NamedExec(
-		`INSERT INTO stats (user_id, type, name, value, html_id, img) VALUES (:user_id, :type, :name, :value, :html_id, :img)`,
-		stats,
-	)
+	if len(stats) != 0 {
+		_, err = tx.NamedExecContext(
+			ctx,
+			`INSERT INTO stats (user_id, snapshot_id, type, name, value, html_id, img) VALUES (:user_id, :snapshot_id, :type, :name, :value, :html_id, :img)`,
+			stats,
+		)
+		if err != nil {
+			domain.Logger(ctx, a.logger).Error("Error inserting new stats!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+	}
+
+	// Charts are shown for the latest snapshot only, so older ones don't keep images
+	_, err = tx.ExecContext(ctx, `UPDATE stats SET img = NULL WHERE user_id = $1 AND snapshot_id <> $2 AND img IS NOT NULL`, userID, snapshot.ID)
 	if err != nil {
-		a.logger.Error("Error inserting new stats!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error deleting images of old snapshots!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		a.logger.Error("Error committing transaction!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error committing transaction!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+
+	snapshot.Stats, err = a.selectStats(ctx, `SELECT * FROM stats WHERE snapshot_id = $1 ORDER BY id`, snapshot.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+func (a *adapter) GetStatsBySnapshotID(ctx context.Context, snapshotID int) ([]*domain.XVMStat, error) {
+	defer metrics.ObserveQuery("GetStatsBySnapshotID", time.Now())
+
+	return a.selectStats(ctx, `SELECT * FROM stats WHERE snapshot_id = $1 ORDER BY id`, snapshotID)
+}
+
+func (a *adapter) GetSnapshotsByUserID(ctx context.Context, userID int) ([]*domain.Snapshot, error) {
+	defer metrics.ObserveQuery("GetSnapshotsByUserID", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT id, user_id, created_at FROM snapshots WHERE user_id = $1 ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error selecting snapshots!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	results := make([]*domain.Snapshot, 0)
+	for rows.Next() {
+		var res domain.Snapshot
+		if err := rows.StructScan(&res); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, nil
+}
+
+func (a *adapter) GetSnapshotByTime(ctx context.Context, userID int, t time.Time) (*domain.Snapshot, error) {
+	defer metrics.ObserveQuery("GetSnapshotByTime", time.Now())
+
+	var snapshot domain.Snapshot
+	err := a.db.QueryRowxContext(
+		ctx,
+		`SELECT id, user_id, created_at FROM snapshots WHERE user_id = $1 ORDER BY abs(extract(EPOCH FROM created_at - $2::timestamptz)), id DESC LIMIT 1`,
+		userID,
+		t,
+	).StructScan(&snapshot)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSnapshotNotFound
+		}
+
+		domain.Logger(ctx, a.logger).Error("Error selecting snapshot!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+
+	snapshot.Stats, err = a.selectStats(ctx, `SELECT * FROM stats WHERE snapshot_id = $1 ORDER BY id`, snapshot.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+func (a *adapter) GetVehicles(ctx context.Context, region domain.Region) ([]*domain.Vehicle, error) {
+	defer metrics.ObserveQuery("GetVehicles", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT * FROM vehicles WHERE region = $1 ORDER BY tier DESC, name`, region)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error selecting vehicles!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	results := make([]*domain.Vehicle, 0)
+	for rows.Next() {
+		var res domain.Vehicle
+		if err := rows.StructScan(&res); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, nil
+}
+
+func (a *adapter) ReplaceVehicles(ctx context.Context, region domain.Region, vehicles []*domain.Vehicle) error {
+	defer metrics.ObserveQuery("ReplaceVehicles", time.Now())
+
+	tx, err := a.db.BeginTxx(ctx, nil)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error beginning database transaction!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	defer func(err *error) {
+		if err != nil && *err != nil {
+			if err := tx.Rollback(); err != nil {
+				domain.Logger(ctx, a.logger).Error("Error while rollback transaction!", zap.Error(err))
+			}
+		}
+	}(&err)
+
+	// Catalog could be refreshed by concurrent requests, so rows are upserted instead of being deleted and inserted again
+	if len(vehicles) != 0 {
+		_, err = tx.NamedExecContext(
+			ctx,
+			`INSERT INTO vehicles (region, tank_id, name, short_name, tier, type, nation) VALUES (:region, :tank_id, :name, :short_name, :tier, :type, :nation)
+ON CONFLICT (region, tank_id) DO UPDATE SET name = EXCLUDED.name, short_name = EXCLUDED.short_name, tier = EXCLUDED.tier, type = EXCLUDED.type, nation = EXCLUDED.nation, updated_at = now();`,
+			vehicles,
+		)
+		if err != nil {
+			domain.Logger(ctx, a.logger).Error("Error upserting vehicles!", zap.Error(err))
+			return domain.ErrInternalDatabase
+		}
+	}
+
+	ids := make([]int64, 0, len(vehicles))
+	for _, v := range vehicles {
+		ids = append(ids, int64(v.TankID))
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM vehicles WHERE region = $1 AND NOT (tank_id = ANY($2))`, region, pq.Array(ids))
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error deleting old vehicles!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error committing transaction!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) GetClanMembers(ctx context.Context, region domain.Region, clanID int) ([]*domain.ClanMember, error) {
+	defer metrics.ObserveQuery("GetClanMembers", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT * FROM clan_members WHERE region = $1 AND clan_id = $2`, region, clanID)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error selecting clan members!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	results := make([]*domain.ClanMember, 0)
+	for rows.Next() {
+		var res domain.ClanMember
+		if err := rows.StructScan(&res); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, nil
+}
+
+func (a *adapter) ReplaceClanMembers(ctx context.Context, region domain.Region, clanID int, members []*domain.ClanMember) error {
+	defer metrics.ObserveQuery("ReplaceClanMembers", time.Now())
+
+	tx, err := a.db.BeginTxx(ctx, nil)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error beginning database transaction!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	defer func(err *error) {
+		if err != nil && *err != nil {
+			if err := tx.Rollback(); err != nil {
+				domain.Logger(ctx, a.logger).Error("Error while rollback transaction!", zap.Error(err))
+			}
+		}
+	}(&err)
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM clan_members WHERE region = $1 AND clan_id = $2`, region, clanID)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error deleting old clan members!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	// Members keep their own updated_at, so stats which are still fresh aren't fetched again
+	if len(members) != 0 {
+		_, err = tx.NamedExecContext(
+			ctx,
+			`INSERT INTO clan_members (region, clan_id, account_id, nickname, role, wn8, winrate, updated_at) VALUES (:region, :clan_id, :account_id, :nickname, :role, :wn8, :winrate, :updated_at)`,
+			members,
+		)
+		if err != nil {
+			domain.Logger(ctx, a.logger).Error("Error inserting new clan members!", zap.Error(err))
+			return domain.ErrInternalDatabase
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error committing transaction!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) GetSubscriptions(ctx context.Context) ([]*domain.Subscription, error) {
+	defer metrics.ObserveQuery("GetSubscriptions", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT s.*, u.telegram_id FROM subscriptions s JOIN users u ON u.id = s.user_id ORDER BY s.user_id`)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error selecting subscriptions!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	results := make([]*domain.Subscription, 0)
+	for rows.Next() {
+		var res domain.Subscription
+		if err := rows.StructScan(&res); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, nil
+}
+
+func (a *adapter) GetSubscriptionByUserID(ctx context.Context, userID int) (*domain.Subscription, error) {
+	defer metrics.ObserveQuery("GetSubscriptionByUserID", time.Now())
+
+	row := a.db.QueryRowxContext(ctx, `SELECT s.*, u.telegram_id FROM subscriptions s JOIN users u ON u.id = s.user_id WHERE s.user_id = $1`, userID)
+	if row.Err() != nil {
+		domain.Logger(ctx, a.logger).Error("Error getting subscription!", zap.Error(row.Err()))
+		return nil, domain.ErrInternalDatabase
+	}
+
+	var res domain.Subscription
+	if err := row.StructScan(&res); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSubscriptionNotFound
+		}
+
+		domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+
+	return &res, nil
+}
+
+func (a *adapter) UpsertSubscription(ctx context.Context, subscription *domain.Subscription) error {
+	defer metrics.ObserveQuery("UpsertSubscription", time.Now())
+
+	_, err := a.db.NamedExecContext(ctx, `INSERT INTO subscriptions (user_id, min_change, snapshot_id, kttc_values)
+VALUES (:user_id, :min_change, :snapshot_id, :kttc_values)
+ON CONFLICT (user_id) DO UPDATE SET min_change = EXCLUDED.min_change, snapshot_id = EXCLUDED.snapshot_id, kttc_values = EXCLUDED.kttc_values, updated_at = now();`, subscription)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error upserting subscription!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+// UpdateSubscriptionBaseline keeps threshold as is, it could be changed by user while notification was being sent
+func (a *adapter) UpdateSubscriptionBaseline(ctx context.Context, subscription *domain.Subscription) error {
+	defer metrics.ObserveQuery("UpdateSubscriptionBaseline", time.Now())
+
+	_, err := a.db.NamedExecContext(ctx, `UPDATE subscriptions SET snapshot_id = :snapshot_id, kttc_values = :kttc_values, updated_at = now() WHERE user_id = :user_id;`, subscription)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error updating subscription baseline!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) DeleteSubscription(ctx context.Context, userID int) error {
+	defer metrics.ObserveQuery("DeleteSubscription", time.Now())
+
+	if _, err := a.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = $1`, userID); err != nil {
+		domain.Logger(ctx, a.logger).Error("Error deleting subscription!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) GetCacheEntry(ctx context.Context, key string) ([]byte, error) {
+	defer metrics.ObserveQuery("GetCacheEntry", time.Now())
+
+	var value []byte
+	if err := a.db.GetContext(ctx, &value, `SELECT value FROM upstream_cache WHERE key = $1 AND expires_at > now()`, key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrCacheEntryNotFound
+		}
+
+		domain.Logger(ctx, a.logger).Error("Error getting cache entry!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+
+	return value, nil
+}
+
+// GetCacheEntries returns values of the keys which are cached and not expired yet
+func (a *adapter) GetCacheEntries(ctx context.Context, keys []string) (map[string][]byte, error) {
+	defer metrics.ObserveQuery("GetCacheEntries", time.Now())
+
+	rows, err := a.db.QueryxContext(ctx, `SELECT key, value FROM upstream_cache WHERE key = ANY($1) AND expires_at > now()`, pq.Array(keys))
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error selecting cache entries!", zap.Error(err))
+		return nil, domain.ErrInternalDatabase
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	values := make(map[string][]byte, len(keys))
+	for rows.Next() {
+		var (
+			key   string
+			value []byte
+		)
+		if err := rows.Scan(&key, &value); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
+			return nil, domain.ErrInternalDatabase
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// SetCacheEntry stores value, expiration time is computed by database to not depend on time zones
+func (a *adapter) SetCacheEntry(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	defer metrics.ObserveQuery("SetCacheEntry", time.Now())
+
+	_, err := a.db.ExecContext(ctx, `INSERT INTO upstream_cache (key, value, expires_at)
+VALUES ($1, $2, now() + $3 * INTERVAL '1 millisecond')
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at;`, key, value, ttl.Milliseconds())
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error upserting cache entry!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
+
+func (a *adapter) DeleteExpiredCacheEntries(ctx context.Context) error {
+	defer metrics.ObserveQuery("DeleteExpiredCacheEntries", time.Now())
+
+	if _, err := a.db.ExecContext(ctx, `DELETE FROM upstream_cache WHERE expires_at <= now()`); err != nil {
+		domain.Logger(ctx, a.logger).Error("Error deleting expired cache entries!", zap.Error(err))
+		return domain.ErrInternalDatabase
+	}
+
+	return nil
+}
 
-	rows, err := a.db.Queryx(`SELECT * FROM stats WHERE user_id = $1`, userID)
+func (a *adapter) selectStats(ctx context.Context, query string, args ...interface{}) ([]*domain.XVMStat, error) {
+	rows, err := a.db.QueryxContext(ctx, query, args...)
 	if err != nil {
-		a.logger.Error("Error selecting stats!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error selecting stats!", zap.Error(err))
 		return nil, domain.ErrInternalDatabase
 	}
 	//noinspection GoUnhandledErrorResult
@@ -176,7 +646,7 @@ func (a *adapter) UpdateStatsByUserID(userID int, stats []*domain.XVMStat) ([]*d
 	for rows.Next() {
 		var res domain.XVMStat
 		if err := rows.StructScan(&res); err != nil {
-			a.logger.Error("Error scanning result!", zap.Error(err))
+			domain.Logger(ctx, a.logger).Error("Error scanning result!", zap.Error(err))
 			return nil, domain.ErrInternalDatabase
 		}
 
@@ -0,0 +1,72 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker opens after threshold failed requests in a row. When cooldown passes, one trial request
+// is let through: its success closes the breaker, failure opens it for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+// done records result of request and reports if the breaker has just opened
+func (b *breaker) done(now time.Time, ok bool) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if ok {
+		b.failures = 0
+		return false
+	}
+
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+
+	opened := now.After(b.openUntil)
+	b.openUntil = now.Add(b.cooldown)
+
+	return opened
+}
+
+// release lets another trial request through, it's called when request was cancelled by caller
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
@@ -0,0 +1,76 @@
+package httpclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &breaker{threshold: 2, cooldown: time.Minute}
+
+	type step struct {
+		name  string
+		at    time.Duration
+		allow bool
+		// Result of the allowed request, opened is expected return of done
+		ok, opened bool
+	}
+
+	steps := []step{
+		{name: "closed", at: 0, allow: true, ok: false},
+		{name: "threshold reached", at: time.Second, allow: true, ok: false, opened: true},
+		{name: "open", at: 30 * time.Second, allow: false},
+		{name: "half-open trial fails", at: 2 * time.Minute, allow: true, ok: false, opened: true},
+		{name: "open again", at: 2*time.Minute + 30*time.Second, allow: false},
+		{name: "half-open trial succeeds", at: 4 * time.Minute, allow: true, ok: true},
+		{name: "closed again", at: 4 * time.Minute, allow: true, ok: true},
+	}
+
+	for _, s := range steps {
+		now := start.Add(s.at)
+		if got := b.allow(now); got != s.allow {
+			t.Fatalf("%s: allow() = %v, want %v", s.name, got, s.allow)
+		}
+		if !s.allow {
+			continue
+		}
+		if got := b.done(now, s.ok); got != s.opened {
+			t.Fatalf("%s: done() = %v, want %v", s.name, got, s.opened)
+		}
+	}
+}
+
+func TestBreakerSingleTrial(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &breaker{threshold: 1, cooldown: time.Minute}
+	b.done(now, false)
+
+	now = now.Add(2 * time.Minute)
+	if !b.allow(now) {
+		t.Fatal("trial request isn't allowed after cooldown")
+	}
+	if b.allow(now) {
+		t.Error("second request is allowed while trial is in flight")
+	}
+
+	// Cancelled trial lets another one through
+	b.release()
+	if !b.allow(now) {
+		t.Error("trial request isn't allowed after release")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &breaker{}
+	for i := 0; i < 10; i++ {
+		if b.done(now, false) {
+			t.Fatal("disabled breaker opened")
+		}
+	}
+
+	if !b.allow(now) {
+		t.Error("disabled breaker doesn't allow requests")
+	}
+}
@@ -0,0 +1,169 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned without doing request while upstream host is considered down
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Client does requests with retries and stops calling hosts which keep failing.
+// It's shared by upstream adapters, every host has its own circuit breaker.
+type Client struct {
+	logger *zap.Logger
+	config *Config
+	client *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	rand     *rand.Rand
+}
+
+func New(logger *zap.Logger, config *Config) *Client {
+	return &Client{
+		logger:   logger,
+		config:   config,
+		client:   &http.Client{},
+		breakers: make(map[string]*breaker),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Do sends request, retrying it if it's idempotent. Timeout of request context covers all attempts.
+// Final 5xx and 429 responses are returned as errors, so callers don't decode error pages.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	b := c.breaker(req.URL.Host)
+	if !b.allow(time.Now()) {
+		return nil, fmt.Errorf("%s: %w", req.URL.Host, ErrCircuitOpen)
+	}
+
+	retries := c.config.Retries
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		retries = 0
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		resp, err = c.client.Do(req)
+		wait, transient := c.transient(req.Context(), resp, err)
+		if !transient {
+			// Cancelled request says nothing about upstream health
+			if err != nil {
+				b.release()
+			} else {
+				b.done(time.Now(), true)
+			}
+			return resp, err
+		}
+
+		if err == nil {
+			err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			//noinspection GoUnhandledErrorResult
+			resp.Body.Close()
+		}
+
+		if attempt >= retries {
+			break
+		}
+
+		if wait <= 0 {
+			wait = c.backoff(attempt)
+		}
+
+		c.logger.Debug(
+			"Retrying upstream request.",
+			zap.String("host", req.URL.Host),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("wait", wait),
+			zap.Error(err),
+		)
+		if !sleep(req.Context(), wait) {
+			b.release()
+			return nil, req.Context().Err()
+		}
+	}
+
+	if req.Context().Err() != nil {
+		b.release()
+	} else if b.done(time.Now(), false) {
+		c.logger.Warn("Upstream host is down, requests to it are stopped!", zap.String("host", req.URL.Host), zap.Duration("cooldown", c.config.BreakerCooldown))
+	}
+
+	return nil, err
+}
+
+// transient reports if request should be retried, Retry-After of 429 response is returned as well
+func (c *Client) transient(ctx context.Context, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		return 0, ctx.Err() == nil
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait := time.Duration(seconds) * time.Second
+			if wait > c.config.BackoffMax {
+				wait = c.config.BackoffMax
+			}
+			return wait, true
+		}
+		return 0, true
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// backoff returns random delay up to exponentially growing limit, so retries of different requests don't come together
+func (c *Client) backoff(attempt int) time.Duration {
+	limit := c.config.BackoffBase << uint(attempt)
+	if limit > c.config.BackoffMax || limit <= 0 {
+		limit = c.config.BackoffMax
+	}
+	if limit <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return limit/2 + time.Duration(c.rand.Int63n(int64(limit/2)+1))
+}
+
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = &breaker{threshold: c.config.BreakerThreshold, cooldown: c.config.BreakerCooldown}
+		c.breakers[host] = b
+	}
+
+	return b
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,239 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestClient(config *Config) *Client {
+	return New(zap.NewNop(), config)
+}
+
+// sequenceServer responds with the statuses one by one, the last one is repeated
+func sequenceServer(statuses []int, header http.Header) (*httptest.Server, *int32) {
+	calls := new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(calls, 1)) - 1
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[n])
+	}))
+
+	return srv, calls
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		header   http.Header
+		calls    int32
+		status   int
+		wantErr  bool
+	}{
+		{name: "success", method: http.MethodGet, statuses: []int{200}, calls: 1, status: 200},
+		{name: "GET is retried after 5xx", method: http.MethodGet, statuses: []int{500, 503, 200}, calls: 3, status: 200},
+		{name: "HEAD is retried", method: http.MethodHead, statuses: []int{502, 200}, calls: 2, status: 200},
+		{name: "429 is retried", method: http.MethodGet, statuses: []int{429, 200}, header: http.Header{"Retry-After": {"0"}}, calls: 2, status: 200},
+		{name: "POST isn't retried", method: http.MethodPost, statuses: []int{500, 200}, calls: 1, wantErr: true},
+		{name: "retries run out", method: http.MethodGet, statuses: []int{500}, calls: 3, wantErr: true},
+		{name: "final 429 is error", method: http.MethodGet, statuses: []int{429}, calls: 3, wantErr: true},
+		{name: "4xx is returned as is", method: http.MethodGet, statuses: []int{404, 200}, calls: 1, status: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := sequenceServer(tt.statuses, tt.header)
+			defer srv.Close()
+
+			c := newTestClient(&Config{Retries: 2, BackoffBase: time.Millisecond, BackoffMax: 5 * time.Millisecond})
+			req, err := http.NewRequest(tt.method, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := c.Do(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				//noinspection GoUnhandledErrorResult
+				defer resp.Body.Close()
+				if resp.StatusCode != tt.status {
+					t.Errorf("Do() status = %d, want %d", resp.StatusCode, tt.status)
+				}
+			}
+			if n := atomic.LoadInt32(calls); n != tt.calls {
+				t.Errorf("server called %d times, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoRetryAfterCap(t *testing.T) {
+	srv, calls := sequenceServer([]int{429, 200}, http.Header{"Retry-After": {"3600"}})
+	defer srv.Close()
+
+	c := newTestClient(&Config{Retries: 1, BackoffBase: time.Millisecond, BackoffMax: 10 * time.Millisecond})
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Do() error: %v, Retry-After isn't capped by BackoffMax", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	resp.Body.Close()
+
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("server called %d times, want 2", n)
+	}
+}
+
+func TestTransientRetryAfter(t *testing.T) {
+	c := newTestClient(&Config{BackoffMax: time.Second})
+
+	tests := []struct {
+		retryAfter string
+		wait       time.Duration
+	}{
+		{"", 0},
+		{"soon", 0},
+		{"0", 0},
+		{"1", time.Second},
+		{"60", time.Second},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if tt.retryAfter != "" {
+			resp.Header.Set("Retry-After", tt.retryAfter)
+		}
+
+		wait, transient := c.transient(context.Background(), resp, nil)
+		if !transient || wait != tt.wait {
+			t.Errorf("transient(Retry-After %q) = %s, %v; want %s, true", tt.retryAfter, wait, transient, tt.wait)
+		}
+	}
+}
+
+func TestDoBreaker(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cooldown := 20 * time.Millisecond
+	c := newTestClient(&Config{BreakerThreshold: 2, BreakerCooldown: cooldown})
+	do := func() error {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := c.Do(req)
+		if err == nil {
+			//noinspection GoUnhandledErrorResult
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := do(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d error = %v, want upstream error", i, err)
+		}
+	}
+	if err := do(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do() of open breaker error = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// Failed trial opens the breaker for another cooldown
+	time.Sleep(cooldown)
+	if err := do(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("trial error = %v, want upstream error", err)
+	}
+	if err := do(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do() after failed trial error = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// Successful trial closes it
+	time.Sleep(cooldown)
+	atomic.StoreInt32(&healthy, 1)
+	for i := 0; i < 3; i++ {
+		if err := do(); err != nil {
+			t.Fatalf("Do() of closed breaker error = %v", err)
+		}
+	}
+}
+
+func TestDoBreakerCancelledTrial(t *testing.T) {
+	var (
+		calls   int32
+		blocked = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			// Trial request hangs until it's cancelled by caller
+			close(blocked)
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	cooldown := 20 * time.Millisecond
+	c := newTestClient(&Config{BreakerThreshold: 1, BreakerCooldown: cooldown})
+	newRequest := func(ctx context.Context) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req.WithContext(ctx)
+	}
+
+	if _, err := c.Do(newRequest(context.Background())); err == nil {
+		t.Fatal("Do() of failing upstream succeeded")
+	}
+	time.Sleep(cooldown)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-blocked
+		cancel()
+	}()
+	if _, err := c.Do(newRequest(ctx)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("trial error = %v, want %v", err, context.Canceled)
+	}
+
+	// Cancelled trial says nothing about upstream, the next request becomes the trial
+	resp, err := c.Do(newRequest(context.Background()))
+	if err != nil {
+		t.Fatalf("Do() after cancelled trial error = %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	resp.Body.Close()
+}
@@ -0,0 +1,11 @@
+package httpclient
+
+import "time"
+
+type Config struct {
+	Retries          int           `long:"retries" env:"RETRIES" description:"Retries of failed upstream request, only network errors, 5xx and 429 responses are retried" default:"2"`
+	BackoffBase      time.Duration `long:"backoff-base" env:"BACKOFF_BASE" description:"Delay before the first retry, it doubles with every next one" default:"200ms"`
+	BackoffMax       time.Duration `long:"backoff-max" env:"BACKOFF_MAX" description:"Maximum delay between retries" default:"2s"`
+	BreakerThreshold int           `long:"breaker-threshold" env:"BREAKER_THRESHOLD" description:"Failed requests in a row after which upstream host is considered down" default:"5"`
+	BreakerCooldown  time.Duration `long:"breaker-cooldown" env:"BREAKER_COOLDOWN" description:"How long requests to the host which is down fail without trying" default:"30s"`
+}
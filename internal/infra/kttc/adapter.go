@@ -3,173 +3,146 @@ package kttc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/infra/httpclient"
+	"github.com/L11R/wotbot/internal/infra/metrics"
 	"go.uber.org/zap"
 )
 
 type adapter struct {
 	logger *zap.Logger
 	config *Config
+	client *httpclient.Client
 }
 
-func NewAdapter(logger *zap.Logger, config *Config) domain.KTTC {
+func NewAdapter(logger *zap.Logger, config *Config, client *httpclient.Client) domain.KTTC {
 	a := &adapter{
 		logger: logger,
 		config: config,
+		client: client,
 	}
 
 	return a
 }
 
-func (a *adapter) GetStats(accountID int) ([]*domain.KTTCStat, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://kttc.ru/wot/ru/statistics/user/get-by-battles/"+fmt.Sprint(accountID)+"/", nil)
+func (a *adapter) GetStats(ctx context.Context, region domain.Region, accountID int) ([]*domain.KTTCWindow, error) {
+	start := time.Now()
+	ww, err := a.getStats(ctx, region, accountID)
+	metrics.ObserveUpstream("kttc", metrics.Outcome(err), start)
+
+	return ww, err
+}
+
+func (a *adapter) getStats(ctx context.Context, region domain.Region, accountID int) ([]*domain.KTTCWindow, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://kttc.ru/wot/%s/statistics/user/get-by-battles/%d/", region, accountID), nil)
 	if err != nil {
-		a.logger.Error("Error creating new KTTC stats request!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error creating new KTTC stats request!", zap.Error(err))
 		return nil, domain.ErrInternalKTTC
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), a.config.HTTPTimeout)
+	ctx, cancel := context.WithTimeout(ctx, a.config.HTTPTimeout)
 	defer cancel()
 	req = req.WithContext(ctx)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.client.Do(req)
 	if err != nil {
-		a.logger.Error("Error doing KTTC stats request!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error doing KTTC stats request!", zap.Error(err))
+		if errors.Is(err, httpclient.ErrCircuitOpen) {
+			return nil, &domain.UnavailableError{Err: domain.ErrInternalKTTC}
+		}
 		return nil, domain.ErrInternalKTTC
 	}
 	//noinspection GoUnhandledErrorResult
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		domain.Logger(ctx, a.logger).Error("Unexpected KTTC API status code!", zap.Int("status_code", resp.StatusCode))
+		return nil, domain.ErrInternalKTTC
+	}
+
 	var apiResp Response
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		a.logger.Error("Error decoding KTTC API response!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error decoding KTTC API response!", zap.Error(err))
 		return nil, domain.ErrInternalKTTC
 	}
 
 	if !apiResp.Success {
-		a.logger.Error("KTTC API returned an error!", zap.Error(fmt.Errorf(apiResp.Message)))
+		domain.Logger(ctx, a.logger).Error("KTTC API returned an error!", zap.String("message", apiResp.Message))
 		return nil, domain.ErrInternalKTTC
 	}
 
 	var sbb StatsByBattles
 	if err := json.Unmarshal(apiResp.Data, &sbb); err != nil {
-		a.logger.Error("Error decoding KTTC API response!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error decoding KTTC API response!", zap.Error(err))
 		return nil, domain.ErrInternalKTTC
 	}
 
-	kttcStats := make([]*domain.KTTCStat, 0)
-	if latest, ok := sbb["1000"]; ok {
-		wn8 := &domain.KTTCStat{
-			Name:  "WN8",
-			Value: latest.WN8,
-			Delta: &latest.Deltas.WN8.Value,
-		}
-
-		switch {
-		case /*latest.WN8 >= 448 &&*/ latest.WN8 < 978:
-			wn8.Color = "❤️"
-		case latest.WN8 >= 978 && latest.WN8 < 1574:
-			wn8.Color = "💛"
-		case latest.WN8 >= 1574 && latest.WN8 < 2371:
-			wn8.Color = "💚"
-		case latest.WN8 >= 2371 && latest.WN8 < 3188:
-			wn8.Color = "💙"
-		case latest.WN8 >= 3188:
-			wn8.Color = "💜"
-		}
-
-		kttcStats = append(kttcStats, wn8)
-
-		wtr := &domain.KTTCStat{
-			Name:  "WTR",
-			Value: float64(latest.WTR),
-			Delta: &latest.Deltas.WTR.Value,
-		}
-
-		switch {
-		case /*latest.WTR >= 2730 &&*/ latest.WTR < 4703:
-			wtr.Color = "❤️"
-		case latest.WTR >= 4703 && latest.WTR < 6800:
-			wtr.Color = "💛"
-		case latest.WTR >= 6800 && latest.WTR < 9050:
-			wtr.Color = "💚"
-		case latest.WTR >= 9050 && latest.WTR < 10496:
-			wtr.Color = "💙"
-		case latest.WTR >= 10496:
-			wtr.Color = "💜"
-		}
-
-		kttcStats = append(kttcStats, wtr)
+	if len(sbb) == 0 {
+		domain.Logger(ctx, a.logger).Error("KTTC API returned no stats windows!")
+		return nil, domain.ErrInternalKTTC
+	}
 
-		winrate := &domain.KTTCStat{
-			Name:  "Процент побед",
-			Value: latest.Winrate,
-			Delta: &latest.Deltas.Winrate.Value,
+	windows := make([]*domain.KTTCWindow, 0, len(sbb))
+	for key, stats := range sbb {
+		if stats == nil {
+			continue
 		}
 
-		switch {
-		case /*latest.Winrate >= 46.44 &&*/ latest.Winrate < 49.2:
-			winrate.Color = "❤️"
-		case latest.Winrate >= 49.2 && latest.Winrate < 52.54:
-			winrate.Color = "💛"
-		case latest.Winrate >= 52.54 && latest.Winrate < 57.81:
-			winrate.Color = "💚"
-		case latest.Winrate >= 57.81 && latest.Winrate < 63.81:
-			winrate.Color = "💙"
-		case latest.Winrate >= 63.81:
-			winrate.Color = "💜"
-		}
-
-		kttcStats = append(kttcStats, winrate)
-
-		damaged := &domain.KTTCStat{
-			Name:  "Средний урон",
-			Value: latest.Damaged,
-			Delta: &latest.Deltas.Damaged.Value,
-		}
+		windows = append(windows, &domain.KTTCWindow{
+			Key:   key,
+			Date:  stats.Date,
+			Stats: newStats(stats),
+		})
+	}
 
+	// Numeric windows go first from the smallest one, the rest (e.g. total) after them
+	sort.Slice(windows, func(i, j int) bool {
+		n, errN := strconv.Atoi(windows[i].Key)
+		m, errM := strconv.Atoi(windows[j].Key)
 		switch {
-		case /*latest.Damaged >= 500 &&*/ latest.Damaged < 750:
-			damaged.Color = "❤️"
-		case latest.Damaged >= 750 && latest.Damaged < 1000:
-			damaged.Color = "💛"
-		case latest.Damaged >= 1000 && latest.Damaged < 1800:
-			damaged.Color = "💚"
-		case latest.Damaged >= 1800 && latest.Damaged < 2500:
-			damaged.Color = "💙"
-		case latest.Damaged >= 2500:
-			damaged.Color = "💜"
+		case errN == nil && errM == nil:
+			return n < m
+		case errN == nil || errM == nil:
+			return errN == nil
 		}
+		return windows[i].Key < windows[j].Key
+	})
 
-		kttcStats = append(kttcStats, damaged)
-
-		hitsPercentage := &domain.KTTCStat{
-			Name:  "Процент попадений",
-			Value: latest.HitsPercentage,
-			Delta: &latest.Deltas.HitsPercentage.Value,
-		}
-
-		switch {
-		case /*latest.HitsPercentage >= 47.5 &&*/ latest.HitsPercentage < 60.5:
-			hitsPercentage.Color = "❤️"
-		case latest.HitsPercentage >= 60.5 && latest.HitsPercentage < 68.5:
-			hitsPercentage.Color = "💛"
-		case latest.HitsPercentage >= 68.5 && latest.HitsPercentage < 74.5:
-			hitsPercentage.Color = "💚"
-		case latest.HitsPercentage >= 74.5 && latest.HitsPercentage < 78.5:
-			hitsPercentage.Color = "💙"
-		case latest.HitsPercentage >= 78.5:
-			hitsPercentage.Color = "💜"
-		}
+	return windows, nil
+}
 
-		kttcStats = append(kttcStats, hitsPercentage)
-	} else {
-		a.logger.Error("Error getting stats for the latest 1000 battles!")
-		return nil, domain.ErrInternalKTTC
+func newStats(stats *Stats) []*domain.KTTCStat {
+	d := stats.Deltas
+	if d == nil {
+		d = &Deltas{}
 	}
 
-	return kttcStats, nil
+	return []*domain.KTTCStat{
+		{Name: "WN8", Metric: domain.MetricWN8, Value: stats.WN8, Precision: 2, Delta: &d.WN8.Value},
+		{Name: "WTR", Metric: domain.MetricWTR, Value: float64(stats.WTR), Precision: 2, Delta: &d.WTR.Value},
+		{Name: "Процент побед", Metric: domain.MetricWinrate, Value: stats.Winrate, Precision: 2, Delta: &d.Winrate.Value},
+		{Name: "Средний урон", Metric: domain.MetricDamage, Value: stats.Damaged, Precision: 2, Delta: &d.Damaged.Value},
+		{Name: "Процент попаданий", Metric: domain.MetricHitsPercents, Value: stats.HitsPercentage, Precision: 2, Delta: &d.HitsPercentage.Value},
+		{Name: "Бои", Value: float64(stats.Battles), Extended: true},
+		{Name: "Победы", Value: float64(stats.Wins), Extended: true},
+		{Name: "Поражения", Value: float64(stats.Losses), Extended: true},
+		{Name: "Ничьи", Value: float64(stats.Ties), Extended: true},
+		{Name: "Средний уровень техники", Value: stats.AverageLevel, Precision: 2, Extended: true},
+		{Name: "Средний уровень боёв", Value: stats.AverageBattlesLevel, Precision: 2, Extended: true},
+		{Name: "Заблокированный урон", Value: stats.Defended, Precision: 2, Extended: true, Delta: &d.Defended.Value},
+		{Name: "Средний опыт", Value: float64(stats.Exp), Extended: true, Delta: &d.Exp.Value},
+		{Name: "Уничтожено за бой", Value: stats.Destroyed, Precision: 2, Extended: true, Delta: &d.Destroyed.Value},
+		{Name: "Обнаружено за бой", Value: stats.Spotting, Precision: 2, Extended: true, Delta: &d.Spotted.Value},
+		{Name: "K/D", Value: stats.KD, Precision: 2, Extended: true, Delta: &d.KD.Value},
+		{Name: "Процент выживания", Value: stats.Survived, Precision: 2, Extended: true, Delta: &d.Survived.Value},
+		{Name: "Очки захвата за бой", Value: stats.BaseCaptured, Precision: 2, Extended: true, Delta: &d.BaseCaptured.Value},
+		{Name: "Очки защиты за бой", Value: stats.BaseDefended, Precision: 2, Extended: true, Delta: &d.BaseDefended.Value},
+	}
 }
@@ -3,7 +3,5 @@ package kttc
 import "time"
 
 type Config struct {
-	ChromeDevtoolsURL string        `long:"chrome-devtools-url" env:"CHROME_DEVTOOLS_URL" description:"Chrome Devtools URL" required:"yes"`
-	HTTPTimeout       time.Duration `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP XVM webpage call timeout" default:"10s"`
-	DevtoolsTimeout   time.Duration `long:"devtools-timeout" env:"DEVTOOLS_TIMEOUT" description:"Devtools XVM webpage call timeout" default:"10s"`
+	HTTPTimeout time.Duration `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP KTTC API call timeout" default:"10s"`
 }
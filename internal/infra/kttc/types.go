@@ -28,6 +28,7 @@ type Stats struct {
 	BaseDefended        float64 `json:"DEF"`
 	HitsPercentage      float64 `json:"HTP,string"`
 	Survived            float64 `json:"LIV"`
+	Destroyed           float64 `json:"DST"`
 	KD                  float64 `json:"KDES"`
 	Max                 string  `json:"MAX"`
 	Date                string  `json:"DATE"`
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+type Adapter interface {
+	ListenAndServe() error
+	Shutdown()
+}
+
+type adapter struct {
+	logger *zap.Logger
+	config *Config
+	server *http.Server
+}
+
+func NewAdapter(logger *zap.Logger, config *Config) Adapter {
+	mux := http.NewServeMux()
+	mux.Handle(config.Path, promhttp.Handler())
+
+	return &adapter{
+		logger: logger,
+		config: config,
+		server: &http.Server{
+			Addr:    config.ListenAddr,
+			Handler: mux,
+		},
+	}
+}
+
+func (a *adapter) ListenAndServe() error {
+	a.logger.Info("Starting serving metrics.", zap.String("addr", a.server.Addr), zap.String("path", a.config.Path))
+
+	if err := a.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (a *adapter) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.ShutdownTimeout)
+	defer cancel()
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.logger.Error("Error shutting down metrics server!", zap.Error(err))
+	}
+}
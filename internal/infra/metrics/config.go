@@ -0,0 +1,10 @@
+package metrics
+
+import "time"
+
+type Config struct {
+	Enabled         bool          `long:"enabled" env:"ENABLED" description:"Serve Prometheus metrics over HTTP"`
+	ListenAddr      string        `long:"listen-addr" env:"LISTEN_ADDR" description:"Address metrics HTTP server listens on" default:":9090"`
+	Path            string        `long:"path" env:"PATH" description:"Path metrics are served on" default:"/metrics"`
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" env:"SHUTDOWN_TIMEOUT" description:"Metrics HTTP server graceful shutdown timeout" default:"5s"`
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes of commands and upstream calls
+const (
+	OutcomeOK          = "ok"
+	OutcomeError       = "error"
+	OutcomeRateLimited = "rate_limited"
+	OutcomeUnavailable = "unavailable"
+)
+
+// Collectors are registered in default registry, so Go runtime metrics (e.g. go_goroutines) are served as well
+var (
+	commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wotbot",
+		Name:      "commands_total",
+		Help:      "Handled commands by command and outcome.",
+	}, []string{"command", "outcome"})
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "wotbot",
+		Name:      "command_duration_seconds",
+		Help:      "Command handling duration, including reply.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"command"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "wotbot",
+		Name:      "upstream_duration_seconds",
+		Help:      "Upstream calls duration by upstream and outcome.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"upstream", "outcome"})
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wotbot",
+		Name:      "upstream_errors_total",
+		Help:      "Failed upstream calls by upstream.",
+	}, []string{"upstream"})
+
+	// Charts are rendered in process, so they aren't mixed with upstream calls
+	chartRenderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "wotbot",
+		Name:      "chart_render_duration_seconds",
+		Help:      "Trend charts rendering duration by outcome.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"outcome"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "wotbot",
+		Name:      "db_query_duration_seconds",
+		Help:      "Database queries duration by adapter method.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+
+	// QueueLength is count of updates waiting for workers
+	QueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "wotbot",
+		Name:      "updates_queue_length",
+		Help:      "Updates waiting for workers.",
+	})
+	// BusyWorkers is count of workers handling updates right now
+	BusyWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "wotbot",
+		Name:      "updates_busy_workers",
+		Help:      "Workers handling updates right now.",
+	})
+)
+
+// Outcome classifies error returned by command handler or upstream adapter
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, domain.ErrRateLimited):
+		return OutcomeRateLimited
+	case errors.Is(err, domain.ErrSourceUnavailable):
+		return OutcomeUnavailable
+	}
+
+	return OutcomeError
+}
+
+// ObserveCommand counts handled command, start is the time handling began
+func ObserveCommand(command, outcome string, start time.Time) {
+	commands.WithLabelValues(command, outcome).Inc()
+	commandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+}
+
+// ObserveUpstream records duration of upstream call, non-ok outcomes are counted as errors
+func ObserveUpstream(upstream, outcome string, start time.Time) {
+	upstreamDuration.WithLabelValues(upstream, outcome).Observe(time.Since(start).Seconds())
+	if outcome != OutcomeOK {
+		upstreamErrors.WithLabelValues(upstream).Inc()
+	}
+}
+
+// ObserveChartRender records duration of chart rendering
+func ObserveChartRender(outcome string, start time.Time) {
+	chartRenderDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// ObserveQuery records duration of database query, it's meant to be deferred
+func ObserveQuery(query string, start time.Time) {
+	queryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
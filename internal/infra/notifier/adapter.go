@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"context"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+	"github.com/L11R/wotbot/internal/infra/scheduler"
+	"go.uber.org/zap"
+)
+
+// Sender delivers notifications outside of incoming updates
+type Sender interface {
+	SendMessage(ctx context.Context, chatID int64, result *domain.Result) error
+}
+
+type job struct {
+	service domain.Service
+	sender  Sender
+}
+
+// NewAdapter returns poller which checks subscribed users one by one spreading them across the interval
+func NewAdapter(logger *zap.Logger, config *Config, service domain.Service, sender Sender) (scheduler.Adapter, error) {
+	return scheduler.NewAdapter(logger, &scheduler.Config{
+		Enabled:     config.Enabled,
+		Interval:    config.Interval,
+		Concurrency: 1,
+	}, &job{
+		service: service,
+		sender:  sender,
+	})
+}
+
+func (j *job) Name() string {
+	return "notify"
+}
+
+func (j *job) TelegramIDs(ctx context.Context) ([]int, error) {
+	return j.service.GetSubscribedTelegramIDs(ctx)
+}
+
+func (j *job) Run(ctx context.Context, telegramID int) error {
+	// There is no update to take client language from, so the one chosen by user or the last seen client one is used
+	lang, err := j.service.GetLanguage(ctx, telegramID, "")
+	if err != nil {
+		return err
+	}
+	ctx = i18n.WithLang(ctx, lang)
+
+	result, sub, err := j.service.GetNotificationMessage(ctx, telegramID)
+	if err != nil {
+		return err
+	}
+
+	// Private chat with user has the same ID as user. Undelivered changes are reported again next time.
+	if result != nil {
+		if err := j.sender.SendMessage(ctx, int64(telegramID), result); err != nil {
+			return err
+		}
+	}
+
+	return j.service.CommitNotification(ctx, sub)
+}
@@ -0,0 +1,8 @@
+package notifier
+
+import "time"
+
+type Config struct {
+	Enabled  bool          `long:"enabled" env:"ENABLED" description:"Check subscribed users for stat changes and notify them"`
+	Interval time.Duration `long:"interval" env:"INTERVAL" description:"How often every subscribed user is checked" default:"1h"`
+}
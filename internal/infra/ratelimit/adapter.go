@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// anyCommand is the limit key used for commands without own limit
+const anyCommand = "*"
+
+type Adapter interface {
+	// Allow takes a token of the command from user and chat buckets, chat ID is zero for private chats.
+	// If there is no token, it returns false and how long to wait for one.
+	Allow(command string, telegramID int, chatID int64) (time.Duration, bool)
+}
+
+// limit allows burst of count requests, then one request per interval
+type limit struct {
+	count    float64
+	interval time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type adapter struct {
+	logger *zap.Logger
+	config *Config
+	user   map[string]*limit
+	chat   map[string]*limit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// Full buckets are dropped every longest period, they don't differ from new ones
+	period time.Duration
+	swept  time.Time
+}
+
+func NewAdapter(logger *zap.Logger, config *Config) (Adapter, error) {
+	a := &adapter{
+		logger:  logger,
+		config:  config,
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+
+	var err error
+	if a.user, err = a.parseLimits(config.User); err != nil {
+		return nil, fmt.Errorf("user limits: %w", err)
+	}
+	if a.chat, err = a.parseLimits(config.Chat); err != nil {
+		return nil, fmt.Errorf("chat limits: %w", err)
+	}
+
+	return a, nil
+}
+
+// parseLimits parses limits like "3/10m" keyed by command
+func (a *adapter) parseLimits(raw map[string]string) (map[string]*limit, error) {
+	limits := make(map[string]*limit, len(raw))
+	for command, value := range raw {
+		parts := strings.SplitN(value, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: limit should look like count/period: %s", command, value)
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("%s: invalid count: %s", command, parts[0])
+		}
+
+		period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("%s: invalid period: %s", command, parts[1])
+		}
+
+		limits[strings.ToLower(strings.TrimSpace(command))] = &limit{
+			count:    float64(count),
+			interval: period / time.Duration(count),
+		}
+		if period > a.period {
+			a.period = period
+		}
+	}
+
+	return limits, nil
+}
+
+func (a *adapter) Allow(command string, telegramID int, chatID int64) (time.Duration, bool) {
+	command = strings.ToLower(command)
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sweep(now)
+
+	// Token is taken only if both buckets have it, so denied request isn't counted anywhere
+	var taken []*bucket
+	var wait time.Duration
+
+	if l, key := lookup(a.user, command); l != nil {
+		b := a.bucket(fmt.Sprintf("user:%d:%s", telegramID, key), l, now)
+		if b.tokens < 1 {
+			wait = l.wait(b)
+		}
+		taken = append(taken, b)
+	}
+
+	if l, key := lookup(a.chat, command); l != nil && chatID != 0 {
+		b := a.bucket(fmt.Sprintf("chat:%d:%s", chatID, key), l, now)
+		if b.tokens < 1 {
+			if w := l.wait(b); w > wait {
+				wait = w
+			}
+		}
+		taken = append(taken, b)
+	}
+
+	if wait > 0 {
+		a.logger.Debug(
+			"Command is rate limited.",
+			zap.String("command", command),
+			zap.Int("telegram_id", telegramID),
+			zap.Int64("chat_id", chatID),
+			zap.Duration("wait", wait),
+		)
+		return wait, false
+	}
+
+	for _, b := range taken {
+		b.tokens--
+	}
+
+	return 0, true
+}
+
+// lookup returns limit of the command and key of its bucket, commands without own limit share the fallback bucket
+func lookup(limits map[string]*limit, command string) (*limit, string) {
+	if l, ok := limits[command]; ok {
+		return l, command
+	}
+
+	return limits[anyCommand], anyCommand
+}
+
+// bucket returns bucket refilled up to now, new buckets are full
+func (a *adapter) bucket(key string, l *limit, now time.Time) *bucket {
+	b, ok := a.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.count, updated: now}
+		a.buckets[key] = b
+	}
+
+	b.tokens += float64(now.Sub(b.updated)) / float64(l.interval)
+	if b.tokens > l.count {
+		b.tokens = l.count
+	}
+	b.updated = now
+
+	return b
+}
+
+// wait returns time until bucket gets one token
+func (l *limit) wait(b *bucket) time.Duration {
+	return time.Duration((1 - b.tokens) * float64(l.interval))
+}
+
+// sweep drops buckets which are surely full by now
+func (a *adapter) sweep(now time.Time) {
+	if now.Sub(a.swept) < a.period {
+		return
+	}
+
+	for key, b := range a.buckets {
+		if now.Sub(b.updated) >= a.period {
+			delete(a.buckets, key)
+		}
+	}
+	a.swept = now
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAllowFallbackBucket(t *testing.T) {
+	a, err := NewAdapter(zap.NewNop(), &Config{
+		User: map[string]string{"*": "2/1h", "refresh": "1/1h"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commands without own limit share one bucket, so switching commands doesn't bypass it
+	for _, command := range []string{"me", "wg"} {
+		if _, ok := a.Allow(command, 1, 0); !ok {
+			t.Fatalf("%s is limited too early", command)
+		}
+	}
+	if _, ok := a.Allow("kttc", 1, 0); ok {
+		t.Error("kttc isn't limited by shared bucket")
+	}
+
+	// Own limit has its own bucket
+	if _, ok := a.Allow("refresh", 1, 0); !ok {
+		t.Error("refresh is limited by shared bucket")
+	}
+	if wait, ok := a.Allow("refresh", 1, 0); ok || wait <= 0 {
+		t.Errorf("second refresh = %s, %v, want limited", wait, ok)
+	}
+
+	// Other users have their own buckets
+	if _, ok := a.Allow("me", 2, 0); !ok {
+		t.Error("other user is limited")
+	}
+}
+
+func TestAllowChat(t *testing.T) {
+	a, err := NewAdapter(zap.NewNop(), &Config{
+		User: map[string]string{"*": "10/1h"},
+		Chat: map[string]string{"*": "1/1h"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.Allow("me", 1, 100); !ok {
+		t.Fatal("first command in chat is limited")
+	}
+	if _, ok := a.Allow("wg", 2, 100); ok {
+		t.Error("chat bucket isn't shared by users")
+	}
+	// Private chats are limited per user only
+	if _, ok := a.Allow("me", 1, 0); !ok {
+		t.Error("private chat is limited by group bucket")
+	}
+}
@@ -0,0 +1,6 @@
+package ratelimit
+
+type Config struct {
+	User map[string]string `long:"user" env:"USER" env-delim:";" description:"Per user limits as command:count/period, * is used for commands without own limit" default:"*:20/1m" default:"refresh:3/10m" default:"save:3/1h"`
+	Chat map[string]string `long:"chat" env:"CHAT" env-delim:";" description:"Per group chat limits as command:count/period, * is used for commands without own limit" default:"*:60/1m"`
+}
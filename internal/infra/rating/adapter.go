@@ -0,0 +1,264 @@
+package rating
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"go.uber.org/zap"
+)
+
+type adapter struct {
+	logger *zap.Logger
+	config *Config
+
+	mu       sync.RWMutex
+	expected map[int]*ExpectedValues
+	loadedAt time.Time
+	failedAt time.Time
+
+	// Only one download runs at a time, callers which waited for it use its result
+	refreshMu  sync.Mutex
+	refreshing int32
+}
+
+func NewAdapter(logger *zap.Logger, config *Config) domain.Rating {
+	a := &adapter{
+		logger: logger,
+		config: config,
+	}
+
+	if err := a.load(); err != nil {
+		a.logger.Warn("Error loading expected values, they will be downloaded on first use!", zap.Error(err))
+	}
+
+	return a
+}
+
+// WN8 computes rating for passed tanks, tanks without expected values are skipped
+func (a *adapter) WN8(stats ...*domain.TankStats) (float64, error) {
+	expected, err := a.table()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		battles                             int
+		damage, frags, spots, defs, wins    float64
+		expDamage, expFrag, expSpot, expDef float64
+		expWins                             float64
+	)
+
+	for _, s := range stats {
+		exp, ok := expected[s.TankID]
+		if !ok || s.Battles == 0 {
+			continue
+		}
+
+		n := float64(s.Battles)
+		battles += s.Battles
+		damage += float64(s.DamageDealt)
+		frags += float64(s.Frags)
+		spots += float64(s.Spotted)
+		defs += float64(s.DroppedCapturePoints)
+		wins += float64(s.Wins)
+
+		expDamage += exp.Damage * n
+		expFrag += exp.Frag * n
+		expSpot += exp.Spot * n
+		expDef += exp.Def * n
+		expWins += exp.WinRate / 100 * n
+	}
+
+	if battles == 0 {
+		return 0, domain.ErrExpectedValuesNotFound
+	}
+
+	rDamage := damage / expDamage
+	rFrag := frags / expFrag
+	rSpot := spots / expSpot
+	rDef := defs / expDef
+	rWin := wins / expWins
+
+	rDamageC := math.Max(0, (rDamage-0.22)/(1-0.22))
+	rWinC := math.Max(0, (rWin-0.71)/(1-0.71))
+	rFragC := math.Max(0, math.Min(rDamageC+0.2, (rFrag-0.12)/(1-0.12)))
+	rSpotC := math.Max(0, math.Min(rDamageC+0.1, (rSpot-0.38)/(1-0.38)))
+	rDefC := math.Max(0, math.Min(rDamageC+0.1, (rDef-0.10)/(1-0.10)))
+
+	return 980*rDamageC + 210*rDamageC*rFragC + 155*rFragC*rSpotC + 75*rDefC*rFragC + 145*math.Min(1.8, rWinC), nil
+}
+
+// table returns loaded expected values, stale table is refreshed in background.
+// Failed refresh isn't retried sooner than retry interval, so broken source isn't called on every request.
+func (a *adapter) table() (map[int]*ExpectedValues, error) {
+	a.mu.RLock()
+	expected, loadedAt, failedAt := a.expected, a.loadedAt, a.failedAt
+	a.mu.RUnlock()
+
+	if expected == nil {
+		return a.initialTable()
+	}
+
+	if time.Since(loadedAt) > a.config.RefreshInterval && time.Since(failedAt) >= a.config.RetryInterval &&
+		atomic.CompareAndSwapInt32(&a.refreshing, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&a.refreshing, 0)
+
+			a.refreshMu.Lock()
+			defer a.refreshMu.Unlock()
+
+			if err := a.refresh(); err != nil {
+				a.logger.Error("Error refreshing expected values!", zap.Error(err))
+			}
+		}()
+	}
+
+	return expected, nil
+}
+
+// initialTable loads the table which isn't loaded yet, concurrent callers wait for the same download
+func (a *adapter) initialTable() (map[int]*ExpectedValues, error) {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	a.mu.RLock()
+	expected, failedAt := a.expected, a.failedAt
+	a.mu.RUnlock()
+
+	if expected != nil {
+		return expected, nil
+	}
+	if time.Since(failedAt) < a.config.RetryInterval {
+		return nil, domain.ErrInternalRating
+	}
+
+	if err := a.refresh(); err != nil {
+		a.logger.Error("Error refreshing expected values!", zap.Error(err))
+		return nil, domain.ErrInternalRating
+	}
+
+	a.mu.RLock()
+	expected = a.expected
+	a.mu.RUnlock()
+
+	return expected, nil
+}
+
+// refresh downloads fresh table if URL is set and reloads it from file, time of failure is remembered.
+// It's called with refreshMu held.
+func (a *adapter) refresh() error {
+	err := a.download()
+	if err == nil {
+		err = a.load()
+	}
+
+	if err != nil {
+		a.mu.Lock()
+		a.failedAt = time.Now()
+		a.mu.Unlock()
+	}
+
+	return err
+}
+
+func (a *adapter) download() error {
+	if a.config.ExpectedValuesURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, a.config.ExpectedValuesURL, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.HTTPTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// Write to temporary file first to never leave broken table on disk
+	tmp, err := ioutil.TempFile(filepath.Dir(a.config.ExpectedValuesPath), "wn8exp-*.json")
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		//noinspection GoUnhandledErrorResult
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if _, err := parseTable(tmp.Name()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), a.config.ExpectedValuesPath)
+}
+
+func (a *adapter) load() error {
+	expected, err := parseTable(a.config.ExpectedValuesPath)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.expected = expected
+	a.loadedAt = time.Now()
+	a.mu.Unlock()
+
+	a.logger.Info("Expected values loaded.", zap.Int("tanks", len(expected)))
+
+	return nil
+}
+
+func parseTable(path string) (map[int]*ExpectedValues, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	var t Table
+	if err := json.NewDecoder(f).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	if len(t.Data) == 0 {
+		return nil, fmt.Errorf("expected values table is empty")
+	}
+
+	expected := make(map[int]*ExpectedValues, len(t.Data))
+	for _, ev := range t.Data {
+		expected[ev.TankID] = ev
+	}
+
+	return expected, nil
+}
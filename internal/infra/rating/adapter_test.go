@@ -0,0 +1,86 @@
+package rating
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"go.uber.org/zap"
+)
+
+const testTable = `{"header":{"version":"1"},"data":[{"IDNum":1,"expDef":1,"expFrag":1,"expSpot":1,"expDamage":1000,"expWinRate":50}]}`
+
+func newTestAdapter(t *testing.T, handler http.HandlerFunc) (a *adapter, calls *int32, cleanup func()) {
+	calls = new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		handler(w, r)
+	}))
+
+	dir, err := ioutil.TempDir("", "rating")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a = NewAdapter(zap.NewNop(), &Config{
+		ExpectedValuesPath: filepath.Join(dir, "wn8exp.json"),
+		ExpectedValuesURL:  srv.URL,
+		RefreshInterval:    time.Hour,
+		RetryInterval:      time.Hour,
+		HTTPTimeout:        time.Second,
+	}).(*adapter)
+
+	return a, calls, func() {
+		srv.Close()
+		//noinspection GoUnhandledErrorResult
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTableConcurrentInitialLoad(t *testing.T) {
+	a, calls, cleanup := newTestAdapter(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte(testTable))
+	})
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.table(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("table downloaded %d times, want 1", n)
+	}
+}
+
+func TestTableBacksOffAfterFailure(t *testing.T) {
+	a, calls, cleanup := newTestAdapter(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.table(); err != domain.ErrInternalRating {
+			t.Fatalf("table() error = %v, want %v", err, domain.ErrInternalRating)
+		}
+	}
+
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("table downloaded %d times, want 1", n)
+	}
+}
@@ -0,0 +1,11 @@
+package rating
+
+import "time"
+
+type Config struct {
+	ExpectedValuesPath string        `long:"expected-values-path" env:"EXPECTED_VALUES_PATH" description:"Path to WN8 expected values table in JSON" default:"wn8exp.json"`
+	ExpectedValuesURL  string        `long:"expected-values-url" env:"EXPECTED_VALUES_URL" description:"URL the expected values table is refreshed from, file is only reloaded if empty" default:"https://static.modxvm.com/wn8-data-exp/json/wn8exp.json"`
+	RefreshInterval    time.Duration `long:"refresh-interval" env:"REFRESH_INTERVAL" description:"Expected values table refresh interval" default:"24h"`
+	RetryInterval      time.Duration `long:"retry-interval" env:"RETRY_INTERVAL" description:"How long failed expected values refresh isn't retried" default:"1m"`
+	HTTPTimeout        time.Duration `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP expected values download timeout" default:"30s"`
+}
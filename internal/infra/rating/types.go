@@ -0,0 +1,18 @@
+package rating
+
+// Table is the community expected values table, the same format XVM publishes
+type Table struct {
+	Header struct {
+		Version string `json:"version"`
+	} `json:"header"`
+	Data []*ExpectedValues `json:"data"`
+}
+
+type ExpectedValues struct {
+	TankID  int     `json:"IDNum"`
+	Def     float64 `json:"expDef"`
+	Frag    float64 `json:"expFrag"`
+	Spot    float64 `json:"expSpot"`
+	Damage  float64 `json:"expDamage"`
+	WinRate float64 `json:"expWinRate"`
+}
@@ -0,0 +1,185 @@
+package scale
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"go.uber.org/zap"
+)
+
+type adapter struct {
+	logger  *zap.Logger
+	config  *Config
+	scales  map[domain.Metric]*MetricScale
+	aliases map[string]domain.Metric
+}
+
+func NewAdapter(logger *zap.Logger, config *Config) (domain.Scales, error) {
+	a := &adapter{
+		logger: logger,
+		config: config,
+	}
+
+	ss := defaultScales
+	if config.Path != "" {
+		custom, err := parseScales(config.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		ss, err = mergeScales(defaultScales, custom)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a.scales = make(map[domain.Metric]*MetricScale, len(ss.Metrics))
+	a.aliases = make(map[string]domain.Metric)
+	for metric, aliases := range defaultAliases {
+		for _, alias := range aliases {
+			a.aliases[strings.ToLower(alias)] = metric
+		}
+	}
+	for name, ms := range ss.Metrics {
+		metric := domain.Metric(name)
+
+		if err := validateGrades(ms.Grades); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		// Region keys are normalized, so both "EU" and "eu" could be used in file
+		regions := make(map[string][]*Grade, len(ms.Regions))
+		for key, gg := range ms.Regions {
+			region, err := domain.ParseRegion(key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w: %s", name, err, key)
+			}
+			if err := validateGrades(gg); err != nil {
+				return nil, fmt.Errorf("%s (%s): %w", name, region, err)
+			}
+			regions[string(region)] = gg
+		}
+
+		a.scales[metric] = &MetricScale{
+			Aliases: ms.Aliases,
+			Grades:  ms.Grades,
+			Regions: regions,
+		}
+		for _, alias := range ms.Aliases {
+			a.aliases[strings.ToLower(alias)] = metric
+		}
+	}
+
+	a.logger.Info("Rating scales loaded.", zap.Int("metrics", len(a.scales)))
+
+	return a, nil
+}
+
+// Grade finds band of the value, region specific grades take precedence; nil means there is no such scale
+func (a *adapter) Grade(region domain.Region, metric domain.Metric, value float64) *domain.Grade {
+	ms, ok := a.scales[metric]
+	if !ok {
+		return nil
+	}
+
+	gg := ms.Grades
+	if rg, ok := ms.Regions[string(region)]; ok {
+		gg = rg
+	}
+
+	if len(gg) == 0 {
+		return nil
+	}
+
+	// Grades are sorted, so the last one not above the value wins
+	g := gg[0]
+	for _, next := range gg[1:] {
+		if value < next.Min {
+			break
+		}
+		g = next
+	}
+
+	return &domain.Grade{
+		Label: g.Label,
+		Emoji: g.Emoji,
+	}
+}
+
+// Metric finds metric by displayed stat name
+func (a *adapter) Metric(name string) (domain.Metric, bool) {
+	metric, ok := a.aliases[strings.ToLower(strings.TrimSpace(name))]
+	return metric, ok
+}
+
+func parseScales(path string) (*Scales, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	// Typos in field names would silently drop the scale otherwise
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	var ss Scales
+	if err := dec.Decode(&ss); err != nil {
+		return nil, err
+	}
+
+	if len(ss.Metrics) == 0 {
+		return nil, fmt.Errorf("rating scales are empty")
+	}
+
+	return &ss, nil
+}
+
+// mergeScales puts custom scales over defaults, so the file may override only some metrics.
+// Fields missing in the custom metric scale are taken from the default one.
+func mergeScales(defaults, custom *Scales) (*Scales, error) {
+	ss := &Scales{
+		Metrics: make(map[string]*MetricScale, len(defaults.Metrics)),
+	}
+	for name, ms := range defaults.Metrics {
+		ss.Metrics[name] = ms
+	}
+
+	for name, ms := range custom.Metrics {
+		def, ok := defaults.Metrics[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown metric: %s", name)
+		}
+
+		merged := *ms
+		if merged.Aliases == nil {
+			merged.Aliases = def.Aliases
+		}
+		if merged.Grades == nil {
+			merged.Grades = def.Grades
+		}
+		if merged.Regions == nil {
+			merged.Regions = def.Regions
+		}
+		ss.Metrics[name] = &merged
+	}
+
+	return ss, nil
+}
+
+func validateGrades(gg []*Grade) error {
+	if len(gg) == 0 {
+		return fmt.Errorf("grades are empty")
+	}
+
+	if !sort.SliceIsSorted(gg, func(i, j int) bool { return gg[i].Min < gg[j].Min }) {
+		return fmt.Errorf("grades must be sorted by min value")
+	}
+
+	return nil
+}
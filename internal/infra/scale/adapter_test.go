@@ -0,0 +1,70 @@
+package scale
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"go.uber.org/zap"
+)
+
+func newTestAdapter(t *testing.T, scales string) (domain.Scales, error) {
+	f, err := ioutil.TempFile("", "scales-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(scales); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewAdapter(zap.NewNop(), &Config{Path: f.Name()})
+}
+
+func TestNewAdapterMergesDefaults(t *testing.T) {
+	a, err := newTestAdapter(t, `{"metrics": {"wn8": {"grades": [{"min": 0, "label": "Custom", "emoji": "⚫️"}]}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g := a.Grade(domain.RegionRU, domain.MetricWN8, 5000); g == nil || g.Label != "Custom" {
+		t.Errorf("wn8 grade = %+v, want custom one", g)
+	}
+	if m, ok := a.Metric("WN8"); !ok || m != domain.MetricWN8 {
+		t.Errorf("Metric(WN8) = %q, %v, default aliases should be kept", m, ok)
+	}
+	if g := a.Grade(domain.RegionRU, domain.MetricWTR, 5000); g == nil {
+		t.Error("wtr grade is nil, default scale should be kept")
+	}
+	if m, ok := a.Metric("Бои"); !ok || m != domain.MetricBattles {
+		t.Errorf("Metric(Бои) = %q, %v, battles should be found without scale", m, ok)
+	}
+	if g := a.Grade(domain.RegionRU, domain.MetricBattles, 5000); g != nil {
+		t.Errorf("battles grade = %+v, want nil", g)
+	}
+}
+
+func TestNewAdapterInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown metric": `{"metrics": {"wn9": {"grades": [{"min": 0}]}}}`,
+		"unknown field":  `{"metrics": {"wn8": {"grade": [{"min": 0}]}}}`,
+		"no grades":      `{"metrics": {"wn8": {"grades": []}}}`,
+		"not graded":     `{"metrics": {"battles": {"aliases": ["Бои"]}}}`,
+		"unsorted":       `{"metrics": {"wn8": {"grades": [{"min": 10}, {"min": 0}]}}}`,
+		"empty":          `{"metrics": {}}`,
+	}
+
+	for name, scales := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newTestAdapter(t, scales); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
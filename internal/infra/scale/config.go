@@ -0,0 +1,5 @@
+package scale
+
+type Config struct {
+	Path string `long:"path" env:"PATH" description:"Path to rating scales in JSON, built-in scales are used if empty"`
+}
@@ -0,0 +1,45 @@
+package scale
+
+import "github.com/L11R/wotbot/internal/domain"
+
+// defaultScales are used when no scales file is configured
+var defaultScales = &Scales{
+	Metrics: map[string]*MetricScale{
+		string(domain.MetricWN8): {
+			Aliases: []string{"WN8"},
+			Grades:  grades(978, 1574, 2371, 3188),
+		},
+		string(domain.MetricWTR): {
+			Aliases: []string{"WTR"},
+			Grades:  grades(4703, 6800, 9050, 10496),
+		},
+		string(domain.MetricWinrate): {
+			Aliases: []string{"Процент побед", "Победы", "Win rate", "Winrate", "Wins"},
+			Grades:  grades(49.2, 52.54, 57.81, 63.81),
+		},
+		string(domain.MetricDamage): {
+			Aliases: []string{"Средний урон", "Урон", "Avg. damage", "Average damage", "Damage"},
+			Grades:  grades(750, 1000, 1800, 2500),
+		},
+		string(domain.MetricHitsPercents): {
+			Aliases: []string{"Процент попаданий", "Процент попадений", "Hit ratio", "Hits"},
+			Grades:  grades(60.5, 68.5, 74.5, 78.5),
+		},
+	},
+}
+
+// defaultAliases name metrics which aren't colored, they are only found among XVM stats by these names
+var defaultAliases = map[domain.Metric][]string{
+	domain.MetricBattles: {"Бои", "Боёв", "Battles"},
+}
+
+// grades builds common five-band scale from thresholds between bands
+func grades(yellow, green, blue, purple float64) []*Grade {
+	return []*Grade{
+		{Min: 0, Label: "Плохо", Emoji: "❤️"},
+		{Min: yellow, Label: "Ниже среднего", Emoji: "💛"},
+		{Min: green, Label: "Хорошо", Emoji: "💚"},
+		{Min: blue, Label: "Отлично", Emoji: "💙"},
+		{Min: purple, Label: "Уникум", Emoji: "💜"},
+	}
+}
@@ -0,0 +1,21 @@
+package scale
+
+// Scales is a file format of rating scales, keyed by metric
+type Scales struct {
+	Metrics map[string]*MetricScale `json:"metrics"`
+}
+
+type MetricScale struct {
+	// Stat names the scale is applied to, e.g. XVM stats are matched only by displayed name
+	Aliases []string `json:"aliases"`
+	Grades  []*Grade `json:"grades"`
+	// Optional per-region grades which replace default ones
+	Regions map[string][]*Grade `json:"regions"`
+}
+
+// Grade starts at Min and lasts until the next one, the first grade also covers values below its Min
+type Grade struct {
+	Min   float64 `json:"min"`
+	Label string  `json:"label"`
+	Emoji string  `json:"emoji"`
+}
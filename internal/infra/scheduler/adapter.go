@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Adapter interface {
+	Run()
+	Shutdown()
+}
+
+type adapter struct {
+	logger *zap.Logger
+	config *Config
+	job    Job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Guards cancellation, so wait group isn't added to after shutdown began waiting for it
+	mu  sync.Mutex
+	wg  sync.WaitGroup
+	sem chan struct{}
+	// Used by Run goroutine only
+	rand *rand.Rand
+}
+
+func NewAdapter(logger *zap.Logger, config *Config, job Job) (Adapter, error) {
+	// Rounds without interval would run back to back and spin on empty user list
+	if config.Interval <= 0 {
+		return nil, fmt.Errorf("%s: interval must be positive, got %s", job.Name(), config.Interval)
+	}
+
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	a := &adapter{
+		logger: logger,
+		config: config,
+		job:    job,
+		sem:    make(chan struct{}, concurrency),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+
+	return a, nil
+}
+
+// Run refreshes users round by round until shutdown, every round takes about one interval
+func (a *adapter) Run() {
+	if !a.track() {
+		return
+	}
+	defer a.wg.Done()
+
+	a.logger.Info("Starting scheduled job.", zap.String("job", a.job.Name()), zap.Duration("interval", a.config.Interval))
+
+	for {
+		start := time.Now()
+		a.round()
+
+		if !a.sleep(a.config.Interval - time.Since(start)) {
+			return
+		}
+	}
+}
+
+func (a *adapter) round() {
+	ids, err := a.job.TelegramIDs(a.ctx)
+	if err != nil {
+		a.logger.Error("Error getting users for scheduled job!", zap.String("job", a.job.Name()), zap.Error(err))
+		return
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	// Runs are spread evenly across the interval, so upstream never gets all of them at once
+	step := a.config.Interval / time.Duration(len(ids))
+	for _, id := range ids {
+		if !a.sleep(step + a.jitter()) {
+			return
+		}
+
+		select {
+		case a.sem <- struct{}{}:
+		case <-a.ctx.Done():
+			return
+		}
+
+		// Slot could be taken even though shutdown has begun, select picks ready case at random
+		if !a.track() {
+			<-a.sem
+			return
+		}
+
+		go func(telegramID int) {
+			defer a.wg.Done()
+			defer func() { <-a.sem }()
+
+			if err := a.job.Run(a.ctx, telegramID); err != nil {
+				a.logger.Warn("Error running scheduled job!", zap.String("job", a.job.Name()), zap.Int("telegram_id", telegramID), zap.Error(err))
+			}
+		}(id)
+	}
+}
+
+// track adds goroutine to wait group unless shutdown has begun
+func (a *adapter) track() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ctx.Err() != nil {
+		return false
+	}
+
+	a.wg.Add(1)
+	return true
+}
+
+// jitter returns random shift in [-Jitter/2, Jitter/2)
+func (a *adapter) jitter() time.Duration {
+	if a.config.Jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(a.rand.Int63n(int64(a.config.Jitter))) - a.config.Jitter/2
+}
+
+// sleep waits for d and reports false if shutdown happened earlier
+func (a *adapter) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return a.ctx.Err() == nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-a.ctx.Done():
+		return false
+	}
+}
+
+// Shutdown stops scheduling, cancels runs which are already in progress and waits for them and Run itself
+func (a *adapter) Shutdown() {
+	a.mu.Lock()
+	a.cancel()
+	a.mu.Unlock()
+
+	a.wg.Wait()
+}
@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type testJob struct{}
+
+func (testJob) Name() string                                   { return "test" }
+func (testJob) TelegramIDs(ctx context.Context) ([]int, error) { return nil, nil }
+func (testJob) Run(ctx context.Context, telegramID int) error  { return nil }
+
+func TestNewAdapterInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewAdapter(zap.NewNop(), &Config{Interval: interval}, testJob{}); err == nil {
+			t.Errorf("NewAdapter(interval %s) expected error", interval)
+		}
+	}
+
+	a, err := NewAdapter(zap.NewNop(), &Config{Interval: time.Hour}, testJob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go a.Run()
+	a.Shutdown()
+}
+
+// blockingJob has many users, every run lasts until shutdown
+type blockingJob struct {
+	started, finished int32
+}
+
+func (*blockingJob) Name() string { return "blocking" }
+
+func (*blockingJob) TelegramIDs(ctx context.Context) ([]int, error) {
+	return []int{1, 2, 3, 4, 5, 6, 7, 8}, nil
+}
+
+func (j *blockingJob) Run(ctx context.Context, telegramID int) error {
+	atomic.AddInt32(&j.started, 1)
+	<-ctx.Done()
+	// Shutdown has to wait for the rest of the run
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(&j.finished, 1)
+	return ctx.Err()
+}
+
+func TestShutdownWaitsForRuns(t *testing.T) {
+	job := &blockingJob{}
+	a, err := NewAdapter(zap.NewNop(), &Config{Interval: 8 * time.Millisecond, Concurrency: 4}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go a.Run()
+	time.Sleep(20 * time.Millisecond)
+	a.Shutdown()
+
+	started, finished := atomic.LoadInt32(&job.started), atomic.LoadInt32(&job.finished)
+	if started == 0 || started != finished {
+		t.Errorf("runs started = %d, finished = %d after shutdown", started, finished)
+	}
+}
+
+func TestShutdownBeforeRun(t *testing.T) {
+	a, err := NewAdapter(zap.NewNop(), &Config{Interval: time.Millisecond}, &blockingJob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Shutdown()
+
+	// Run after shutdown returns at once instead of scheduling runs nobody waits for
+	done := make(chan struct{})
+	go func() {
+		a.Run()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Run() didn't return after shutdown")
+	}
+}
@@ -0,0 +1,10 @@
+package scheduler
+
+import "time"
+
+type Config struct {
+	Enabled     bool          `long:"enabled" env:"ENABLED" description:"Refresh stats of users who opted in automatically"`
+	Interval    time.Duration `long:"interval" env:"INTERVAL" description:"How often every user is refreshed, refreshes are spread across it" default:"24h"`
+	Concurrency int           `long:"concurrency" env:"CONCURRENCY" description:"Max refreshes running at the same time" default:"2"`
+	Jitter      time.Duration `long:"jitter" env:"JITTER" description:"Random shift of every refresh to avoid regular load spikes" default:"1m"`
+}
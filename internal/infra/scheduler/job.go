@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/L11R/wotbot/internal/domain"
+)
+
+// Job is a task run for every returned user once per interval
+type Job interface {
+	Name() string
+	TelegramIDs(ctx context.Context) ([]int, error)
+	Run(ctx context.Context, telegramID int) error
+}
+
+type refreshJob struct {
+	refresher domain.Refresher
+}
+
+// NewRefreshJob refreshes stats of users who enabled /autorefresh
+func NewRefreshJob(refresher domain.Refresher) Job {
+	return &refreshJob{refresher: refresher}
+}
+
+func (j *refreshJob) Name() string {
+	return "refresh"
+}
+
+func (j *refreshJob) TelegramIDs(ctx context.Context) ([]int, error) {
+	return j.refresher.GetAutoRefreshTelegramIDs(ctx)
+}
+
+func (j *refreshJob) Run(ctx context.Context, telegramID int) error {
+	return j.refresher.RefreshStats(ctx, telegramID)
+}
@@ -1,28 +1,93 @@
 package telegram
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
 	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+	"github.com/L11R/wotbot/internal/renderer"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
 	"go.uber.org/zap"
 )
 
+// Telegram rejects media captions which are longer, it counts UTF-16 code units
+const captionLimit = 1024
+
 type Adapter interface {
 	ListenAndServe() error
+	SendMessage(ctx context.Context, chatID int64, result *domain.Result) error
 	Shutdown()
 }
 
+// Limiter decides if user may run the command now, see ratelimit package
+type Limiter interface {
+	Allow(command string, telegramID int, chatID int64) (time.Duration, bool)
+}
+
 type adapter struct {
-	logger  *zap.Logger
-	config  *Config
-	botAPI  *tgbotapi.BotAPI
-	service domain.Service
+	logger     *zap.Logger
+	config     *Config
+	botAPI     *tgbotapi.BotAPI
+	service    domain.Service
+	limiter    Limiter
+	renderer   *renderer.Renderer
+	server     *http.Server
+	dispatcher *dispatcher
+	// Path of webhook URL with secret part, e.g. /bot/<secret>
+	webhookPath string
+	// Closed on shutdown in polling mode, library doesn't close updates channel itself
+	stop chan struct{}
+
+	// Parent of all requests contexts, cancelled on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewAdapter(logger *zap.Logger, config *Config, service domain.Service) (Adapter, error) {
+func NewAdapter(logger *zap.Logger, config *Config, service domain.Service, limiter Limiter) (Adapter, error) {
 	a := &adapter{
-		logger:  logger,
-		config:  config,
-		service: service,
+		logger:   logger,
+		config:   config,
+		service:  service,
+		limiter:  limiter,
+		renderer: renderer.New(renderer.FormatHTML),
+		stop:     make(chan struct{}),
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.dispatcher = newDispatcher(config.Workers, config.QueueSize, a.route)
+
+	if config.Mode == webhookMode {
+		if config.Webhook.URL == "" || config.Webhook.SecretPath == "" {
+			return nil, errors.New("webhook URL and secret path are required in webhook mode")
+		}
+		if (config.Webhook.CertFile == "") != (config.Webhook.KeyFile == "") {
+			return nil, errors.New("webhook certificate and key files are required together")
+		}
+		if config.Webhook.SelfSigned && config.Webhook.CertFile == "" {
+			return nil, errors.New("webhook certificate file is required to upload self-signed certificate")
+		}
+
+		link, err := url.Parse(config.Webhook.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook URL: %w", err)
+		}
+		a.webhookPath = path.Join("/", link.Path, config.Webhook.SecretPath)
+
+		a.server = &http.Server{
+			Addr:    config.Webhook.ListenAddr,
+			Handler: http.HandlerFunc(a.handleWebhook),
+		}
 	}
 
 	bot, err := tgbotapi.NewBotAPI(config.Token)
@@ -37,8 +102,28 @@ func NewAdapter(logger *zap.Logger, config *Config, service domain.Service) (Ada
 }
 
 func (a *adapter) ListenAndServe() error {
+	if a.config.Mode == webhookMode {
+		return a.listenWebhook()
+	}
+
+	return a.listenPolling()
+}
+
+func (a *adapter) listenPolling() error {
 	a.logger.Info("Starting listening and serving Telegram Bot updates.")
 
+	// Updates can't be received with getUpdates while webhook is set
+	info, err := a.botAPI.GetWebhookInfo()
+	if err != nil {
+		return err
+	}
+	if info.IsSet() {
+		a.logger.Warn("Removing previously set webhook!", zap.String("url", info.URL))
+		if _, err := a.botAPI.RemoveWebhook(); err != nil {
+			return err
+		}
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
@@ -47,13 +132,192 @@ func (a *adapter) ListenAndServe() error {
 		return err
 	}
 
-	for u := range uu {
-		go a.route(&u)
+	for {
+		select {
+		case <-a.stop:
+			return nil
+		case u := <-uu:
+			if err := a.dispatcher.Dispatch(a.ctx, &u); err != nil {
+				a.logger.Warn("Dropping update!", zap.Int("update_id", u.UpdateID), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (a *adapter) listenWebhook() error {
+	a.logger.Info("Starting serving Telegram Bot updates via webhook.", zap.String("addr", a.server.Addr))
+
+	if err := a.setWebhook(); err != nil {
+		return err
+	}
+
+	var err error
+	if a.config.Webhook.CertFile != "" {
+		err = a.server.ListenAndServeTLS(a.config.Webhook.CertFile, a.config.Webhook.KeyFile)
+	} else {
+		err = a.server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// setWebhook registers webhook, library doesn't support secret token so it's called directly
+func (a *adapter) setWebhook() error {
+	link := strings.TrimSuffix(a.config.Webhook.URL, "/") + "/" + a.config.Webhook.SecretPath
+
+	params := map[string]string{
+		"url":             link,
+		"max_connections": strconv.Itoa(a.config.Webhook.MaxConnections),
+	}
+	if a.config.Webhook.SecretToken != "" {
+		params["secret_token"] = a.config.Webhook.SecretToken
+	}
+
+	if a.config.Webhook.SelfSigned {
+		_, err := a.botAPI.UploadFile("setWebhook", params, "certificate", a.config.Webhook.CertFile)
+		return err
+	}
+
+	v := url.Values{}
+	for key, value := range params {
+		v.Set(key, value)
+	}
+
+	_, err := a.botAPI.MakeRequest("setWebhook", v)
+	return err
+}
+
+func (a *adapter) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !a.isWebhookPath(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if a.config.Webhook.SecretToken != "" {
+		token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Webhook.SecretToken)) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	var u tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		a.logger.Error("Error decoding webhook update!", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Telegram redelivers update if it isn't accepted, e.g. while the bot is shutting down
+	if err := a.dispatcher.Dispatch(r.Context(), &u); err != nil {
+		a.logger.Warn("Rejecting webhook update!", zap.Int("update_id", u.UpdateID), zap.Error(err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// isWebhookPath reports if request is sent to webhook URL, reverse proxy may strip its path prefix as well
+func (a *adapter) isWebhookPath(p string) bool {
+	p = path.Clean("/" + p)
+	return p == a.webhookPath || p == path.Join("/", a.config.Webhook.SecretPath)
+}
+
+// sender returns user who sent the update, nil if there is no one
+func sender(u *tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case u.Message != nil:
+		return u.Message.From
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.From
+	case u.InlineQuery != nil:
+		return u.InlineQuery.From
 	}
 
 	return nil
 }
 
+// requestContext bounds update handling with timeout and passes update info to logs
+func (a *adapter) requestContext(u *tgbotapi.Update) (context.Context, context.CancelFunc) {
+	r := &domain.Request{UpdateID: u.UpdateID}
+	if from := sender(u); from != nil {
+		r.TelegramID = from.ID
+	}
+
+	return context.WithTimeout(domain.WithRequest(a.ctx, r), a.config.RequestTimeout)
+}
+
+// withLang puts language of the user to context, client language is used if stored one can't be read
+func (a *adapter) withLang(ctx context.Context, from *tgbotapi.User) context.Context {
+	if from == nil {
+		return ctx
+	}
+
+	lang, err := a.service.GetLanguage(ctx, from.ID, from.LanguageCode)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error getting user language!", zap.Error(err))
+		lang = i18n.Match(from.LanguageCode)
+	}
+
+	return i18n.WithLang(ctx, lang)
+}
+
+// render formats result as Telegram HTML in language of the request
+func (a *adapter) render(ctx context.Context, result *domain.Result) string {
+	return a.renderer.Render(i18n.FromContext(ctx), result)
+}
+
+// chartCaption returns rendered stats as caption of the chart if they fit into caption limit,
+// otherwise the chart name is returned and stats have to be sent separately
+func (a *adapter) chartCaption(ctx context.Context, result *domain.Result, chart *domain.XVMStat) (string, bool) {
+	// Limit is checked against HTML, so it's stricter than Telegram which counts text without tags
+	if text := a.render(ctx, result); len(utf16.Encode([]rune(text))) <= captionLimit {
+		return text, true
+	}
+
+	return "<b>" + html.EscapeString(i18n.Sprintf(i18n.FromContext(ctx), chart.Name)) + "</b>", false
+}
+
+// SendMessage sends message outside of incoming updates, e.g. notifications
+func (a *adapter) SendMessage(ctx context.Context, chatID int64, result *domain.Result) error {
+	// Bot API library doesn't take context, so only already cancelled work is dropped
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
+
+	_, err := a.botAPI.Send(msg)
+	return err
+}
+
+// Shutdown stops receiving updates, waits for queued ones and cancels those which don't fit into drain timeout
 func (a *adapter) Shutdown() {
-	a.botAPI.StopReceivingUpdates()
+	defer a.cancel()
+
+	if a.server == nil {
+		close(a.stop)
+		a.botAPI.StopReceivingUpdates()
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.Webhook.ShutdownTimeout)
+		defer cancel()
+
+		if err := a.server.Shutdown(ctx); err != nil {
+			a.logger.Error("Error shutting down webhook server!", zap.Error(err))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.DrainTimeout)
+	defer cancel()
+
+	if err := a.dispatcher.Shutdown(ctx); err != nil {
+		a.logger.Warn("Updates weren't drained in time, cancelling them!", zap.Error(err))
+	}
 }
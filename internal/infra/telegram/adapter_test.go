@@ -0,0 +1,30 @@
+package telegram
+
+import "testing"
+
+func TestIsWebhookPath(t *testing.T) {
+	a := &adapter{
+		config:      &Config{Webhook: &WebhookConfig{SecretPath: "secret"}},
+		webhookPath: "/bot/secret",
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/bot/secret", true},
+		{"/bot/secret/", true},
+		// Prefix is stripped by reverse proxy
+		{"/secret", true},
+		{"/bot", false},
+		{"/other/secret", false},
+		{"/bot/secret/more", false},
+		{"/", false},
+	}
+
+	for _, tt := range tests {
+		if got := a.isWebhookPath(tt.path); got != tt.want {
+			t.Errorf("isWebhookPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
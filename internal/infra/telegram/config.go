@@ -2,8 +2,33 @@ package telegram
 
 import "time"
 
+const (
+	pollingMode = "polling"
+	webhookMode = "webhook"
+)
+
 type Config struct {
-	Token        string        `short:"t" long:"token" env:"TOKEN" description:"Telegram Bot API token" required:"yes"`
-	Debug        bool          `long:"debug" env:"DEBUG" description:"Debug logs for Telegram Bot API adapter"`
-	AutoDeleting time.Duration `long:"auto-deleting" env:"AUTO_DELETING" description:"Messages auto-deleting in supergroups" default:"1m"`
+	Token           string        `short:"t" long:"token" env:"TOKEN" description:"Telegram Bot API token" required:"yes"`
+	Debug           bool          `long:"debug" env:"DEBUG" description:"Debug logs for Telegram Bot API adapter"`
+	AutoDeleting    time.Duration `long:"auto-deleting" env:"AUTO_DELETING" description:"Messages auto-deleting in supergroups" default:"1m"`
+	InlineCacheTime time.Duration `long:"inline-cache-time" env:"INLINE_CACHE_TIME" description:"How long Telegram may cache inline query results" default:"5m"`
+	RequestTimeout  time.Duration `long:"request-timeout" env:"REQUEST_TIMEOUT" description:"Update handling timeout, unfinished upstream requests are cancelled after it" default:"1m"`
+	Workers         int           `long:"workers" env:"WORKERS" description:"Number of updates handled concurrently, updates of one user are handled in order" default:"8"`
+	QueueSize       int           `long:"queue-size" env:"QUEUE_SIZE" description:"Updates waiting for workers, receiving is paused when queue is full" default:"64"`
+	DrainTimeout    time.Duration `long:"drain-timeout" env:"DRAIN_TIMEOUT" description:"How long queued updates are handled on shutdown before being cancelled" default:"30s"`
+	Mode            string        `long:"mode" env:"MODE" description:"Updates receiving mode" choice:"polling" choice:"webhook" default:"polling"`
+
+	Webhook *WebhookConfig `group:"Webhook args" namespace:"webhook" env-namespace:"WEBHOOK"`
+}
+
+type WebhookConfig struct {
+	ListenAddr      string        `long:"listen-addr" env:"LISTEN_ADDR" description:"Address webhook HTTP server listens on" default:":8443"`
+	URL             string        `long:"url" env:"URL" description:"Public webhook URL, secret path is appended to it"`
+	SecretPath      string        `long:"secret-path" env:"SECRET_PATH" description:"Secret path part of webhook URL"`
+	SecretToken     string        `long:"secret-token" env:"SECRET_TOKEN" description:"Token Telegram sends in X-Telegram-Bot-Api-Secret-Token header"`
+	CertFile        string        `long:"cert-file" env:"CERT_FILE" description:"TLS certificate file, plain HTTP is served without it (e.g. behind reverse proxy)"`
+	KeyFile         string        `long:"key-file" env:"KEY_FILE" description:"TLS private key file"`
+	SelfSigned      bool          `long:"self-signed" env:"SELF_SIGNED" description:"Upload certificate to Telegram, required for self-signed ones"`
+	MaxConnections  int           `long:"max-connections" env:"MAX_CONNECTIONS" description:"Maximum simultaneous webhook connections from Telegram" default:"40"`
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" env:"SHUTDOWN_TIMEOUT" description:"Webhook HTTP server graceful shutdown timeout" default:"10s"`
 }
@@ -0,0 +1,137 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/L11R/wotbot/internal/infra/metrics"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+var errDispatcherStopped = errors.New("dispatcher is stopped")
+
+// dispatcher handles updates with fixed number of workers. Updates of the same user
+// (or chat, if there is no sender) always go to the same worker, so they are handled in order.
+type dispatcher struct {
+	handle func(u *tgbotapi.Update)
+	queues []chan *tgbotapi.Update
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	stopped bool
+	stop    chan struct{}
+	// Dispatch calls which are waiting for queue, queues can be closed only after them
+	senders sync.WaitGroup
+	closing sync.Once
+}
+
+func newDispatcher(workers, queueSize int, handle func(u *tgbotapi.Update)) *dispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// Queue size is shared between workers
+	size := queueSize / workers
+	if size <= 0 {
+		size = 1
+	}
+
+	d := &dispatcher{
+		handle: handle,
+		queues: make([]chan *tgbotapi.Update, workers),
+		stop:   make(chan struct{}),
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan *tgbotapi.Update, size)
+
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+func (d *dispatcher) work(queue <-chan *tgbotapi.Update) {
+	defer d.wg.Done()
+
+	for u := range queue {
+		metrics.QueueLength.Dec()
+		metrics.BusyWorkers.Inc()
+		d.handle(u)
+		metrics.BusyWorkers.Dec()
+	}
+}
+
+// Dispatch queues update, it blocks while worker's queue is full
+func (d *dispatcher) Dispatch(ctx context.Context, u *tgbotapi.Update) error {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return errDispatcherStopped
+	}
+	d.senders.Add(1)
+	d.mu.Unlock()
+	defer d.senders.Done()
+
+	// Counted in advance, otherwise worker could take the update before it's counted
+	metrics.QueueLength.Inc()
+	select {
+	case d.queues[d.shard(u)] <- u:
+		return nil
+	case <-d.stop:
+		metrics.QueueLength.Dec()
+		return errDispatcherStopped
+	case <-ctx.Done():
+		metrics.QueueLength.Dec()
+		return ctx.Err()
+	}
+}
+
+func (d *dispatcher) shard(u *tgbotapi.Update) int {
+	var key int64
+	if from := sender(u); from != nil {
+		key = int64(from.ID)
+	} else if u.Message != nil && u.Message.Chat != nil {
+		key = u.Message.Chat.ID
+	}
+
+	// Group chats IDs are negative
+	if key < 0 {
+		key = -key
+	}
+
+	return int(key % int64(len(d.queues)))
+}
+
+// Shutdown stops accepting updates and waits until queued ones are handled,
+// it returns context error if deadline comes earlier
+func (d *dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.stopped {
+		d.stopped = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+
+	d.closing.Do(func() {
+		d.senders.Wait()
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,5 +1,14 @@
 package telegram
 
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+)
+
 type humanReadableError interface {
 	error
 	Human() string
@@ -9,11 +18,18 @@ type humanReadableError interface {
 // Human-readable Error
 type hrError struct {
 	human string
+	args  []interface{}
 	error error
 }
 
-func newHRError(human string, err error) humanReadableError {
-	return &hrError{human: human, error: err}
+// newHRError takes message in Russian, it's translated on sending, args are formatted into it
+func newHRError(human string, err error, args ...interface{}) humanReadableError {
+	return &hrError{human: human, args: args, error: err}
+}
+
+// rateLimited asks user to wait, waiting time is rounded up to minutes
+func rateLimited(wait time.Duration, err error) humanReadableError {
+	return newHRError("Слишком много запросов! Попробуй снова через %d мин.", err, int(math.Ceil(wait.Minutes())))
 }
 
 // Just to complain error interface, it should be named String() I guess
@@ -28,3 +44,32 @@ func (e *hrError) Human() string {
 func (e *hrError) Cause() error {
 	return e.error
 }
+
+func (e *hrError) Unwrap() error {
+	return e.error
+}
+
+// sourceUnavailable replaces message of the error caused by source which is down, handlers don't check it
+// one by one, since user can't do anything but wait anyway
+func sourceUnavailable(hrerr *hrError) *hrError {
+	err := hrerr.Cause()
+	if !errors.Is(err, domain.ErrSourceUnavailable) {
+		return hrerr
+	}
+
+	switch {
+	case errors.Is(err, domain.ErrInternalWargaming):
+		return &hrError{human: "Wargaming API временно недоступен, попробуй позже.", error: err}
+	case errors.Is(err, domain.ErrInternalXVM):
+		return &hrError{human: "XVM временно недоступен, попробуй позже.", error: err}
+	case errors.Is(err, domain.ErrInternalKTTC):
+		return &hrError{human: "KTTC временно недоступен, попробуй позже.", error: err}
+	}
+
+	return &hrError{human: "Источник данных временно недоступен, попробуй позже.", error: err}
+}
+
+// Translate returns human-readable message in the language
+func (e *hrError) Translate(lang i18n.Lang) string {
+	return i18n.Sprintf(lang, e.human, e.args...)
+}
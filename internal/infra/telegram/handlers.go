@@ -1,33 +1,92 @@
 package telegram
 
 import (
+	"context"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+	"github.com/L11R/wotbot/internal/infra/metrics"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
 	"go.uber.org/zap"
 )
 
+// kttcExtendedArg asks /kttc to show all metrics instead of the main ones
+const kttcExtendedArg = "full"
+
+// handlerFunc handles command message and returns sent reply
+type handlerFunc func(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error)
+
 func (a *adapter) route(u *tgbotapi.Update) {
-	if u.Message == nil { // ignore any non-Message Updates
+	// Updates left in queue after drain timeout are dropped, their replies would fail anyway
+	if a.ctx.Err() != nil {
+		a.logger.Warn("Dropping update, bot is shutting down!", zap.Int("update_id", u.UpdateID))
+		return
+	}
+
+	// Plain group chatter, unknown commands and commands of other bots aren't handled,
+	// so they are neither queried for nor rate limited nor counted
+	var handle handlerFunc
+	if u.Message != nil && u.Message.LeftChatMember == nil {
+		if handle = a.handler(u.Message); handle == nil {
+			return
+		}
+	}
+
+	ctx, cancel := a.requestContext(u)
+	defer cancel()
+	ctx = a.withLang(ctx, sender(u))
+
+	if u.InlineQuery != nil {
+		a.handleInlineQuery(ctx, u)
+		return
+	}
+
+	if u.CallbackQuery != nil {
+		a.handleCallbackQuery(ctx, u)
+		return
+	}
+
+	if u.Message == nil { // ignore any other non-Message Updates
+		return
+	}
+
+	// Members who left aren't shown in /top anymore
+	if u.Message.LeftChatMember != nil {
+		if u.Message.Chat != nil {
+			if err := a.service.ForgetChatMember(ctx, u.Message.Chat.ID, u.Message.LeftChatMember.ID); err != nil {
+				domain.Logger(ctx, a.logger).Error("Error forgetting chat member!", zap.Error(err))
+			}
+		}
 		return
 	}
 
+	// Group members are remembered for /top when they send commands, users who never used the bot are skipped by service
+	if u.Message.From != nil && u.Message.Chat != nil && (u.Message.Chat.IsGroup() || u.Message.Chat.IsSuperGroup()) {
+		if err := a.service.TrackChatMember(ctx, u.Message.Chat.ID, u.Message.From.ID); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error tracking chat member!", zap.Error(err))
+		}
+	}
+
 	var (
 		sentMsg *tgbotapi.Message
 		err     error
+		start   = time.Now()
 	)
 
 	defer func(err *error) {
 		if r := recover(); r != nil {
-			a.logger.Error("panic recoved!", zap.Any("panic", r))
+			domain.Logger(ctx, a.logger).Error("panic recoved!", zap.Any("panic", r))
 			return
 		}
 
+		metrics.ObserveCommand(u.Message.Command(), metrics.Outcome(*err), start)
+
 		if err != nil && *err != nil {
-			sentMsg = a.error(u, *err)
+			sentMsg = a.error(ctx, u, *err)
 		}
 
 		if u.Message.Chat != nil && u.Message.Chat.Type == "supergroup" {
@@ -44,29 +103,75 @@ func (a *adapter) route(u *tgbotapi.Update) {
 		}
 	}(&err)
 
-	switch u.Message.Command() {
+	if u.Message.From != nil {
+		// Private chats are limited per user only
+		var chatID int64
+		if u.Message.Chat != nil && !u.Message.Chat.IsPrivate() {
+			chatID = u.Message.Chat.ID
+		}
+
+		if wait, ok := a.limiter.Allow(u.Message.Command(), u.Message.From.ID, chatID); !ok {
+			err = rateLimited(wait, &domain.RateLimitError{Wait: wait})
+			return
+		}
+	}
+
+	sentMsg, err = handle(ctx, u)
+}
+
+// handler returns handler of the command, nil means the message isn't a command of this bot
+func (a *adapter) handler(m *tgbotapi.Message) handlerFunc {
+	if !m.IsCommand() {
+		return nil
+	}
+
+	// Commands addressed to other bots in the same group look like "/me@OtherBot"
+	if command := m.CommandWithAt(); strings.Contains(command, "@") {
+		if !strings.EqualFold(command[strings.Index(command, "@")+1:], a.botAPI.Self.UserName) {
+			return nil
+		}
+	}
+
+	switch m.Command() {
 	case "start":
-		sentMsg, err = a.handleStart(u)
+		return a.handleStart
 	case "get":
-		sentMsg, err = a.handleGet(u)
+		return a.handleGet
 	case "save":
-		sentMsg, err = a.handleSave(u)
+		return a.handleSave
 	case "me":
-		sentMsg, err = a.handleMe(u)
+		return a.handleMe
 	case "refresh":
-		sentMsg, err = a.handleRefresh(u)
+		return a.handleRefresh
+	case "autorefresh":
+		return a.handleAutoRefresh
+	case "notify":
+		return a.handleNotify
 	case "kttc":
-		sentMsg, err = a.handleKTTC(u)
-	default:
-		if strings.HasSuffix(u.Message.Command(), "Trend") ||
-			strings.Contains(u.Message.Command(), "ByVehicle") {
-			sentMsg, err = a.handleTrend(u)
-		}
+		return a.handleKTTC
+	case "wg":
+		return a.handleWargaming
+	case "tank":
+		return a.handleTank
+	case "compare":
+		return a.handleCompare
+	case "clan":
+		return a.handleClan
+	case "top":
+		return a.handleTop
+	case "diff":
+		return a.handleDiff
+	case "region":
+		return a.handleRegion
+	case "lang":
+		return a.handleLang
 	}
+
+	return nil
 }
 
-func (a *adapter) handleStart(u *tgbotapi.Update) (*tgbotapi.Message, error) {
-	text, err := a.service.GetCreateUserMessage(u.Message.From.ID)
+func (a *adapter) handleStart(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetCreateUserMessage(ctx, u.Message.From.ID)
 	if err != nil {
 		if errors.Is(err, domain.ErrInternalDatabase) {
 			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
@@ -75,7 +180,7 @@ func (a *adapter) handleStart(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
-	msg := tgbotapi.NewMessage(u.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
 	msg.ParseMode = "HTML"
 	sentMsg, err := a.botAPI.Send(msg)
 	if err != nil {
@@ -85,12 +190,12 @@ func (a *adapter) handleStart(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) handleGet(u *tgbotapi.Update) (*tgbotapi.Message, error) {
+func (a *adapter) handleGet(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	if u.Message.CommandArguments() == "" {
 		return nil, newHRError("Никнейм не передан!", domain.ErrBotBadRequest)
 	}
 
-	text, err := a.service.GetStatsMessage(u.Message.CommandArguments())
+	result, err := a.service.GetStatsMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
 	if err != nil {
 		if errors.Is(err, domain.ErrInternalWargaming) {
 			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
@@ -98,6 +203,9 @@ func (a *adapter) handleGet(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		if errors.Is(err, domain.ErrPlayerNotFound) {
 			return nil, newHRError("Игрок с данным никнеймом не найден!", err)
 		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
 		if errors.Is(err, domain.ErrInternalXVM) {
 			return nil, newHRError("Ошибка при обращении к XVM!", err)
 		}
@@ -105,7 +213,7 @@ func (a *adapter) handleGet(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
-	msg := tgbotapi.NewMessage(u.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
 	msg.ParseMode = "HTML"
 	sentMsg, err := a.botAPI.Send(msg)
 	if err != nil {
@@ -115,12 +223,26 @@ func (a *adapter) handleGet(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) handleKTTC(u *tgbotapi.Update) (*tgbotapi.Message, error) {
-	if u.Message.CommandArguments() == "" {
+func (a *adapter) handleKTTC(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	// Nickname goes first, then optional window and extended view flag in any order
+	args := strings.Fields(u.Message.CommandArguments())
+	if len(args) == 0 {
 		return nil, newHRError("Никнейм не передан!", domain.ErrBotBadRequest)
 	}
+	var (
+		window   string
+		extended bool
+	)
+	for _, arg := range args[1:] {
+		switch strings.ToLower(arg) {
+		case kttcExtendedArg, "подробно":
+			extended = true
+		default:
+			window = arg
+		}
+	}
 
-	text, err := a.service.GetKTTCStatsMessage(u.Message.CommandArguments())
+	result, err := a.service.GetKTTCStatsMessage(ctx, u.Message.From.ID, args[0], window, extended)
 	if err != nil {
 		if errors.Is(err, domain.ErrInternalWargaming) {
 			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
@@ -128,6 +250,9 @@ func (a *adapter) handleKTTC(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		if errors.Is(err, domain.ErrPlayerNotFound) {
 			return nil, newHRError("Игрок с данным никнеймом не найден!", err)
 		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
 		if errors.Is(err, domain.ErrInternalKTTC) {
 			return nil, newHRError("Ошибка при обращении к KTTC!", err)
 		}
@@ -135,7 +260,7 @@ func (a *adapter) handleKTTC(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
-	msg := tgbotapi.NewMessage(u.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
 	msg.ParseMode = "HTML"
 	msg.DisableWebPagePreview = true
 	sentMsg, err := a.botAPI.Send(msg)
@@ -146,12 +271,139 @@ func (a *adapter) handleKTTC(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) handleSave(u *tgbotapi.Update) (*tgbotapi.Message, error) {
+func (a *adapter) handleWargaming(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	if u.Message.CommandArguments() == "" {
 		return nil, newHRError("Никнейм не передан!", domain.ErrBotBadRequest)
 	}
 
-	text, err := a.service.GetSaveNicknameMessage(u.Message.From.ID, u.Message.CommandArguments())
+	result, err := a.service.GetWargamingStatsMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrInternalWargaming) {
+			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
+		}
+		if errors.Is(err, domain.ErrPlayerNotFound) {
+			return nil, newHRError("Игрок с данным никнеймом не найден!", err)
+		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleCompare(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetCompareMessage(ctx, u.Message.From.ID, strings.Fields(u.Message.CommandArguments()))
+	if err != nil {
+		if errors.Is(err, domain.ErrBotBadRequest) {
+			return nil, newHRError("Передай от двух до четырёх никнеймов, например: /compare nick1 nick2", err)
+		}
+		if errors.Is(err, domain.ErrInternalWargaming) {
+			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
+		}
+		if errors.Is(err, domain.ErrPlayerNotFound) {
+			return nil, newHRError("Один из игроков не найден!", err)
+		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
+		if errors.Is(err, domain.ErrInternalKTTC) || errors.Is(err, domain.ErrInternalXVM) {
+			return nil, newHRError("Ошибка при обращении к KTTC и XVM!", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleClan(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	if u.Message.CommandArguments() == "" {
+		return nil, newHRError("Тег клана не передан!", domain.ErrBotBadRequest)
+	}
+
+	result, err := a.service.GetClanMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrInternalWargaming) {
+			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
+		}
+		if errors.Is(err, domain.ErrClanNotFound) {
+			return nil, newHRError("Клан с данным тегом не найден!", err)
+		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleTop(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	if u.Message.Chat == nil || !u.Message.Chat.IsGroup() && !u.Message.Chat.IsSuperGroup() {
+		return nil, newHRError("Команда работает только в группах!", domain.ErrBotBadRequest)
+	}
+
+	result, err := a.service.GetTopMessage(ctx, u.Message.Chat.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrBotBadRequest) {
+			return nil, newHRError("Неизвестный показатель! Доступны: wn8, winrate, damage, battles.", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleTank(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	// Vehicle name may consist of several words, extra spaces between them are dropped
+	args := strings.Fields(u.Message.CommandArguments())
+	if len(args) < 2 {
+		return nil, newHRError("Передай никнейм и название техники, например: /tank nickname Об. 140", domain.ErrBotBadRequest)
+	}
+
+	result, err := a.service.GetTankStatsMessage(ctx, u.Message.From.ID, args[0], strings.Join(args[1:], " "))
 	if err != nil {
 		if errors.Is(err, domain.ErrInternalWargaming) {
 			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
@@ -159,6 +411,48 @@ func (a *adapter) handleSave(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		if errors.Is(err, domain.ErrPlayerNotFound) {
 			return nil, newHRError("Игрок с данным никнеймом не найден!", err)
 		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
+		if errors.Is(err, domain.ErrVehicleNotFound) {
+			return nil, newHRError("Техника с таким названием не найдена!", err)
+		}
+		if errors.Is(err, domain.ErrTankStatsNotFound) {
+			return nil, newHRError("Игрок не играл на этой технике!", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleSave(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	if u.Message.CommandArguments() == "" {
+		return nil, newHRError("Никнейм не передан!", domain.ErrBotBadRequest)
+	}
+
+	result, err := a.service.GetSaveNicknameMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrInternalWargaming) {
+			return nil, newHRError("Ошибка при обращении к Wargaming API!", err)
+		}
+		if errors.Is(err, domain.ErrPlayerNotFound) {
+			return nil, newHRError("Игрок с данным никнеймом не найден!", err)
+		}
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
 		if errors.Is(err, domain.ErrInternalXVM) {
 			return nil, newHRError("Ошибка при обращении к XVM!", err)
 		}
@@ -169,7 +463,7 @@ func (a *adapter) handleSave(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
-	msg := tgbotapi.NewMessage(u.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
 	msg.ParseMode = "HTML"
 	sentMsg, err := a.botAPI.Send(msg)
 	if err != nil {
@@ -179,9 +473,13 @@ func (a *adapter) handleSave(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) handleRefresh(u *tgbotapi.Update) (*tgbotapi.Message, error) {
-	text, err := a.service.GetRefreshMessage(u.Message.From.ID)
+func (a *adapter) handleRefresh(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetRefreshMessage(ctx, u.Message.From.ID)
 	if err != nil {
+		var rlerr *domain.RateLimitError
+		if errors.As(err, &rlerr) {
+			return nil, rateLimited(rlerr.Wait, err)
+		}
 		if errors.Is(err, domain.ErrInternalXVM) {
 			return nil, newHRError("Ошибка при обращении к XVM!", err)
 		}
@@ -195,7 +493,79 @@ func (a *adapter) handleRefresh(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
-	msg := tgbotapi.NewMessage(u.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleRegion(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetRegionMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownRegion) {
+			return nil, newHRError("Неизвестный регион! Доступны: ru, eu, na, asia.", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleLang(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetLanguageMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownLanguage) {
+			return nil, newHRError("Неизвестный язык! Доступны: ru, en.", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleAutoRefresh(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetAutoRefreshMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
+	if err != nil {
+		if errors.Is(err, domain.ErrBotBadRequest) {
+			return nil, newHRError("Передай on или off, например: /autorefresh on", err)
+		}
+		if errors.Is(err, domain.ErrNicknameNotSaved) || errors.Is(err, domain.ErrUserNotFound) {
+			return nil, newHRError("Сначала сохрани свой никнейм!", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
 	msg.ParseMode = "HTML"
 	sentMsg, err := a.botAPI.Send(msg)
 	if err != nil {
@@ -205,11 +575,14 @@ func (a *adapter) handleRefresh(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) handleMe(u *tgbotapi.Update) (*tgbotapi.Message, error) {
-	text, err := a.service.GetMeMessage(u.Message.From.ID, u.Message.Chat.Type)
+func (a *adapter) handleNotify(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, err := a.service.GetNotifyMessage(ctx, u.Message.From.ID, u.Message.CommandArguments())
 	if err != nil {
-		if errors.Is(err, domain.ErrTrendImageNotFound) {
-			return nil, newHRError("График не найден!", err)
+		if errors.Is(err, domain.ErrBotBadRequest) {
+			return nil, newHRError("Передай on с необязательным порогом в процентах или off, например: /notify on 3", err)
+		}
+		if errors.Is(err, domain.ErrNicknameNotSaved) || errors.Is(err, domain.ErrUserNotFound) {
+			return nil, newHRError("Сначала сохрани свой никнейм!", err)
 		}
 		if errors.Is(err, domain.ErrInternalDatabase) {
 			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
@@ -218,7 +591,7 @@ func (a *adapter) handleMe(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
-	msg := tgbotapi.NewMessage(u.Message.Chat.ID, text)
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
 	msg.ParseMode = "HTML"
 	sentMsg, err := a.botAPI.Send(msg)
 	if err != nil {
@@ -228,8 +601,8 @@ func (a *adapter) handleMe(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) handleTrend(u *tgbotapi.Update) (*tgbotapi.Message, error) {
-	img, err := a.service.GetTrendImage(u.Message.From.ID, "#"+u.Message.Command())
+func (a *adapter) handleMe(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	result, charts, err := a.service.GetMeMessage(ctx, u.Message.From.ID)
 	if err != nil {
 		if errors.Is(err, domain.ErrNicknameNotSaved) {
 			return nil, newHRError("Сначала сохрани свой никнейм!", err)
@@ -241,10 +614,35 @@ func (a *adapter) handleTrend(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 		return nil, newHRError("Произошла неизвестная ошибка!", err)
 	}
 
+	if len(charts) == 0 {
+		msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+		msg.ParseMode = "HTML"
+		sentMsg, err := a.botAPI.Send(msg)
+		if err != nil {
+			return nil, newHRError("Невозможно отправить сообщение!", err)
+		}
+
+		return &sentMsg, nil
+	}
+
+	// Stats are shown as a caption of the first chart, others are available with keyboard.
+	// Stats which don't fit into caption go in a separate message before the chart.
+	caption, fits := a.chartCaption(ctx, result, charts[0])
+	if !fits {
+		msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+		msg.ParseMode = "HTML"
+		if _, err := a.botAPI.Send(msg); err != nil {
+			return nil, newHRError("Невозможно отправить сообщение!", err)
+		}
+	}
+
 	msg := tgbotapi.NewPhotoUpload(u.Message.Chat.ID, tgbotapi.FileBytes{
-		Name:  u.Message.Command(),
-		Bytes: img,
+		Name:  "chart.png",
+		Bytes: charts[0].Image,
 	})
+	msg.Caption = caption
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = chartsKeyboard(i18n.FromContext(ctx), u.Message.From.ID, charts, charts[0].HtmlID)
 	sentMsg, err := a.botAPI.Send(msg)
 	if err != nil {
 		return nil, newHRError("Невозможно отправить сообщение!", err)
@@ -253,21 +651,163 @@ func (a *adapter) handleTrend(u *tgbotapi.Update) (*tgbotapi.Message, error) {
 	return &sentMsg, nil
 }
 
-func (a *adapter) error(update *tgbotapi.Update, err error) *tgbotapi.Message {
+func (a *adapter) handleDiff(ctx context.Context, u *tgbotapi.Update) (*tgbotapi.Message, error) {
+	period, err := parsePeriod(u.Message.CommandArguments())
+	if err != nil {
+		return nil, newHRError("Неверный период! Например: 7, 7d или 2w.", domain.ErrBotBadRequest)
+	}
+
+	result, err := a.service.GetDiffMessage(ctx, u.Message.From.ID, period)
+	if err != nil {
+		if errors.Is(err, domain.ErrNicknameNotSaved) || errors.Is(err, domain.ErrUserNotFound) {
+			return nil, newHRError("Сначала сохрани свой никнейм!", err)
+		}
+		if errors.Is(err, domain.ErrSnapshotNotFound) {
+			return nil, newHRError("Пока не с чем сравнивать, обнови статистику позже: /refresh", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return nil, newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return nil, newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	msg := tgbotapi.NewMessage(u.Message.Chat.ID, a.render(ctx, result))
+	msg.ParseMode = "HTML"
+	sentMsg, err := a.botAPI.Send(msg)
+	if err != nil {
+		return nil, newHRError("Невозможно отправить сообщение!", err)
+	}
+
+	return &sentMsg, nil
+}
+
+func (a *adapter) handleCallbackQuery(ctx context.Context, u *tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			domain.Logger(ctx, a.logger).Error("panic recoved!", zap.Any("panic", r))
+		}
+	}()
+
+	var err error
+	switch {
+	case strings.HasPrefix(u.CallbackQuery.Data, chartCallbackPrefix):
+		err = a.handleChartCallback(ctx, u)
+	default:
+		err = newHRError("Неизвестная кнопка!", domain.ErrBotBadRequest)
+	}
+
+	callback := tgbotapi.NewCallback(u.CallbackQuery.ID, "")
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error occurred in callback handler!", zap.Error(err))
+
+		if hrerr, ok := err.(*hrError); ok {
+			callback = tgbotapi.NewCallbackWithAlert(u.CallbackQuery.ID, sourceUnavailable(hrerr).Translate(i18n.FromContext(ctx)))
+		}
+	}
+
+	if _, err := a.botAPI.AnswerCallbackQuery(callback); err != nil {
+		domain.Logger(ctx, a.logger).Error("Error answering callback query!", zap.Error(err))
+	}
+}
+
+func (a *adapter) handleChartCallback(ctx context.Context, u *tgbotapi.Update) error {
+	if u.CallbackQuery.Message == nil {
+		return newHRError("Сообщение устарело, запроси статистику заново: /me", domain.ErrBotBadRequest)
+	}
+
+	ownerID, key, shown, err := parseChartCallback(u.CallbackQuery.Data)
+	if err != nil {
+		return newHRError("Неизвестная кнопка!", err)
+	}
+
+	// Telegram refuses to replace chart with the same one
+	if shown {
+		return nil
+	}
+
+	result, charts, err := a.service.GetMeMessage(ctx, ownerID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNicknameNotSaved) {
+			return newHRError("Игрок больше не сохранён!", err)
+		}
+		if errors.Is(err, domain.ErrInternalDatabase) {
+			return newHRError("Ошибка при работе с базой! Обратитесь к администратору бота.", err)
+		}
+
+		return newHRError("Произошла неизвестная ошибка!", err)
+	}
+
+	// Stats could be refreshed since the keyboard was sent, so there may be no such chart anymore
+	chart := findChart(charts, key)
+	if chart == nil {
+		return newHRError("График не найден!", domain.ErrBotBadRequest)
+	}
+
+	caption, _ := a.chartCaption(ctx, result, chart)
+	if err := a.editMessagePhoto(
+		u.CallbackQuery.Message.Chat.ID,
+		u.CallbackQuery.Message.MessageID,
+		chart.Image,
+		caption,
+		chartsKeyboard(i18n.FromContext(ctx), ownerID, charts, chart.HtmlID),
+	); err != nil {
+		return newHRError("Невозможно обновить сообщение!", err)
+	}
+
+	return nil
+}
+
+func (a *adapter) handleInlineQuery(ctx context.Context, u *tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			domain.Logger(ctx, a.logger).Error("panic recoved!", zap.Any("panic", r))
+		}
+	}()
+
+	results, err := a.service.GetInlineQueryResults(ctx, u.InlineQuery.From.ID, u.InlineQuery.Query)
+	if err != nil {
+		// Nothing to show to user here, just answer with an empty list
+		domain.Logger(ctx, a.logger).Error("Error getting inline query results!", zap.String("query", u.InlineQuery.Query), zap.Error(err))
+	}
+
+	articles := make([]interface{}, 0, len(results))
+	for _, r := range results {
+		text := a.render(ctx, r.Result)
+		article := tgbotapi.NewInlineQueryResultArticleHTML(r.ID, r.Title, text)
+		article.Description = r.Description
+		article.InputMessageContent = tgbotapi.InputTextMessageContent{
+			Text:                  text,
+			ParseMode:             "HTML",
+			DisableWebPagePreview: true,
+		}
+		articles = append(articles, article)
+	}
+
+	if _, err := a.botAPI.AnswerInlineQuery(tgbotapi.InlineConfig{
+		InlineQueryID: u.InlineQuery.ID,
+		Results:       articles,
+		CacheTime:     int(a.config.InlineCacheTime.Seconds()),
+	}); err != nil {
+		domain.Logger(ctx, a.logger).Error("Error answering inline query!", zap.String("query", u.InlineQuery.Query), zap.Error(err))
+	}
+}
+
+func (a *adapter) error(ctx context.Context, update *tgbotapi.Update, err error) *tgbotapi.Message {
 	if update == nil || err == nil {
 		// Why did you call this function?
 		return nil
 	}
 
 	// Log error
-	a.logger.Error("Error occurred in handler!", zap.Error(err))
+	domain.Logger(ctx, a.logger).Error("Error occurred in handler!", zap.Error(err))
 
 	// Send human readable representation of error to user to let him know
 	if hrerr, ok := err.(*hrError); ok {
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, hrerr.Human())
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, sourceUnavailable(hrerr).Translate(i18n.FromContext(ctx)))
 		sentMsg, err := a.botAPI.Send(msg)
 		if err != nil {
-			a.logger.Error("Error sending message with human readable error!", zap.Error(err))
+			domain.Logger(ctx, a.logger).Error("Error sending message with human readable error!", zap.Error(err))
 			return nil
 		}
 
@@ -290,3 +830,30 @@ func (a *adapter) deleteMessage(chatID int64, messageID int) {
 		)
 	}
 }
+
+// parsePeriod parses period in days (7, 7d) or weeks (2w), one week by default
+func parsePeriod(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 7 * 24 * time.Hour, nil
+	}
+
+	unit := 24 * time.Hour
+	switch {
+	case strings.HasSuffix(s, "w"):
+		unit *= 7
+		s = strings.TrimSuffix(s, "w")
+	case strings.HasSuffix(s, "d"):
+		s = strings.TrimSuffix(s, "d")
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, domain.ErrBotBadRequest
+	}
+
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,37 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestHandler(t *testing.T) {
+	a := &adapter{botAPI: &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "WotBot"}}}
+
+	command := func(text string, length int) *tgbotapi.Message {
+		return &tgbotapi.Message{
+			Text:     text,
+			Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		message *tgbotapi.Message
+		want    bool
+	}{
+		{"known", command("/me", 3), true},
+		{"with arguments", command("/kttc nick", 5), true},
+		{"addressed to this bot", command("/me@wotbot", 10), true},
+		{"addressed to other bot", command("/me@OtherBot", 12), false},
+		{"unknown", command("/unknown", 8), false},
+		{"plain text", &tgbotapi.Message{Text: "hello"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := a.handler(tt.message) != nil; got != tt.want {
+			t.Errorf("%s: handler(%q) found = %v, want %v", tt.name, tt.message.Text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// Callback data format is chart:<owner telegram_id>:<html_id without #>[:shown], chart of the shown button is already displayed.
+	// Charts are found by html_id, so buttons keep pointing to the same chart after stats are refreshed.
+	chartCallbackPrefix = "chart:"
+	chartShownSuffix    = ":shown"
+	selectedChartMark   = "• "
+	chartButtonsPerRow  = 2
+	// Telegram rejects keyboards with longer callback data
+	callbackDataLimit = 64
+)
+
+func chartCallbackData(ownerID int, htmlID string, shown bool) string {
+	data := fmt.Sprintf("%s%d:%s", chartCallbackPrefix, ownerID, strings.TrimPrefix(htmlID, "#"))
+	if shown {
+		data += chartShownSuffix
+	}
+
+	return data
+}
+
+// parseChartCallback returns chart owner, html_id without # and whether the chart is already shown
+func parseChartCallback(data string) (int, string, bool, error) {
+	shown := strings.HasSuffix(data, chartShownSuffix)
+	parts := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(data, chartCallbackPrefix), chartShownSuffix), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", false, domain.ErrBotBadRequest
+	}
+
+	ownerID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", false, domain.ErrBotBadRequest
+	}
+
+	return ownerID, parts[1], shown, nil
+}
+
+// findChart returns chart by its html_id without #, nil if there is no such chart
+func findChart(charts []*domain.XVMStat, key string) *domain.XVMStat {
+	for _, c := range charts {
+		if c.HtmlID == "#"+key {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// chartsKeyboard builds keyboard with a button per chart, the selected one is marked
+func chartsKeyboard(lang i18n.Lang, ownerID int, charts []*domain.XVMStat, selected string) tgbotapi.InlineKeyboardMarkup {
+	var (
+		rows [][]tgbotapi.InlineKeyboardButton
+		row  []tgbotapi.InlineKeyboardButton
+	)
+
+	for _, c := range charts {
+		text := i18n.Sprintf(lang, c.Name)
+		if c.HtmlID == selected {
+			text = selectedChartMark + text
+		}
+
+		data := chartCallbackData(ownerID, c.HtmlID, c.HtmlID == selected)
+		if len(data) > callbackDataLimit {
+			continue
+		}
+
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(text, data))
+		if len(row) == chartButtonsPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// editMessagePhoto replaces photo, caption and keyboard of already sent message.
+// Library doesn't support editMessageMedia method, so it's called directly.
+func (a *adapter) editMessagePhoto(chatID int64, messageID int, img []byte, caption string, markup tgbotapi.InlineKeyboardMarkup) error {
+	media, err := json.Marshal(map[string]string{
+		"type":       "photo",
+		"media":      "attach://chart",
+		"caption":    caption,
+		"parse_mode": "HTML",
+	})
+	if err != nil {
+		return err
+	}
+
+	replyMarkup, err := json.Marshal(markup)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.botAPI.UploadFile(
+		"editMessageMedia",
+		map[string]string{
+			"chat_id":      strconv.FormatInt(chatID, 10),
+			"message_id":   strconv.Itoa(messageID),
+			"media":        string(media),
+			"reply_markup": string(replyMarkup),
+		},
+		"chart",
+		tgbotapi.FileBytes{Name: "chart.png", Bytes: img},
+	)
+
+	return err
+}
@@ -0,0 +1,74 @@
+package telegram
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+)
+
+func TestChartCallback(t *testing.T) {
+	tests := []struct {
+		data    string
+		ownerID int
+		key     string
+		shown   bool
+		wantErr bool
+	}{
+		{data: chartCallbackData(42, "#winrateTrend", false), ownerID: 42, key: "winrateTrend"},
+		{data: chartCallbackData(42, "#winrateTrend", true), ownerID: 42, key: "winrateTrend", shown: true},
+		{data: "chart:42:", wantErr: true},
+		{data: "chart:x:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			ownerID, key, shown, err := parseChartCallback(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChartCallback() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (ownerID != tt.ownerID || key != tt.key || shown != tt.shown) {
+				t.Errorf("parseChartCallback() = %d, %q, %v; want %d, %q, %v", ownerID, key, shown, tt.ownerID, tt.key, tt.shown)
+			}
+		})
+	}
+}
+
+func TestFindChart(t *testing.T) {
+	charts := []*domain.XVMStat{{HtmlID: "#a"}, {HtmlID: "#b"}}
+
+	if c := findChart(charts, "b"); c != charts[1] {
+		t.Errorf("findChart() = %v, want %v", c, charts[1])
+	}
+	// Indexes aren't keys, charts could be reordered since the keyboard was sent
+	for _, key := range []string{"0", "c", "#a"} {
+		if c := findChart(charts, key); c != nil {
+			t.Errorf("findChart(%q) = %v, want nil", key, c)
+		}
+	}
+}
+
+func TestChartsKeyboardCallbackDataLimit(t *testing.T) {
+	charts := make([]*domain.XVMStat, 20)
+	for i := range charts {
+		charts[i] = &domain.XVMStat{Name: "chart", HtmlID: "#chart" + strings.Repeat("x", i*4)}
+	}
+
+	keyboard := chartsKeyboard(i18n.Russian, math.MaxInt32, charts, charts[len(charts)-1].HtmlID)
+	buttons := 0
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			buttons++
+			if button.CallbackData == nil || len(*button.CallbackData) > callbackDataLimit {
+				t.Errorf("callback data %v exceeds %d bytes", button.CallbackData, callbackDataLimit)
+			}
+		}
+	}
+
+	// Short html_ids get buttons, too long ones are skipped
+	if buttons == 0 || buttons == len(charts) {
+		t.Errorf("keyboard has %d buttons of %d charts", buttons, len(charts))
+	}
+}
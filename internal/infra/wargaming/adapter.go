@@ -3,73 +3,438 @@ package wargaming
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/infra/httpclient"
+	"github.com/L11R/wotbot/internal/infra/metrics"
 	"go.uber.org/zap"
 )
 
 type adapter struct {
 	logger *zap.Logger
 	config *Config
+	client *httpclient.Client
 }
 
-func NewAdapter(logger *zap.Logger, config *Config) domain.Wargaming {
+func NewAdapter(logger *zap.Logger, config *Config, client *httpclient.Client) domain.Wargaming {
 	a := &adapter{
 		logger: logger,
 		config: config,
+		client: client,
 	}
 
 	return a
 }
 
-func (a *adapter) FindPlayer(nickname string) (string, int, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://api.worldoftanks.ru/wot/account/list/", nil)
+const (
+	// Maximum count of account IDs in one request
+	accountIDsLimit = 100
+	// Error message of request rejected by application_id limit
+	requestLimitExceeded = "REQUEST_LIMIT_EXCEEDED"
+	// Times rejected request is sent again
+	requestLimitRetries = 3
+)
+
+// Every region is served by its own API cluster
+var apiHosts = map[domain.Region]string{
+	domain.RegionRU:   "https://api.worldoftanks.ru",
+	domain.RegionEU:   "https://api.worldoftanks.eu",
+	domain.RegionNA:   "https://api.worldoftanks.com",
+	domain.RegionASIA: "https://api.worldoftanks.asia",
+}
+
+func (a *adapter) applicationID(region domain.Region) string {
+	if id, ok := a.config.ApplicationIDs[string(region)]; ok {
+		return id
+	}
+
+	return a.config.ApplicationID
+}
+
+func (a *adapter) FindPlayer(ctx context.Context, region domain.Region, nickname string) (string, int, error) {
+	pp, err := a.SearchPlayers(ctx, region, nickname, 0)
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, p := range pp {
+		if strings.ToLower(p.Nickname) == strings.ToLower(nickname) {
+			return p.Nickname, p.AccountID, nil
+		}
+	}
+
+	return "", 0, domain.ErrPlayerNotFound
+}
+
+func (a *adapter) SearchPlayers(ctx context.Context, region domain.Region, nickname string, limit int) ([]*domain.Player, error) {
+	params := url.Values{}
+	params.Set("search", nickname)
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	var pp []PlayerData
+	if _, err := a.call(ctx, region, "/wot/account/list/", params, &pp); err != nil {
+		return nil, err
+	}
+
+	players := make([]*domain.Player, 0, len(pp))
+	for _, p := range pp {
+		players = append(players, &domain.Player{
+			Nickname:  p.Nickname,
+			AccountID: p.AccountID,
+		})
+	}
+
+	return players, nil
+}
+
+func (a *adapter) GetAccountInfo(ctx context.Context, region domain.Region, accountID int) (*domain.AccountInfo, error) {
+	infos, err := a.GetAccountsInfo(ctx, region, []int{accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := infos[accountID]
+	if !ok {
+		return nil, domain.ErrPlayerNotFound
+	}
+
+	return info, nil
+}
+
+// GetAccountsInfo requests accounts by batches, unknown accounts are missing in result
+func (a *adapter) GetAccountsInfo(ctx context.Context, region domain.Region, accountIDs []int) (map[int]*domain.AccountInfo, error) {
+	infos := make(map[int]*domain.AccountInfo, len(accountIDs))
+	for _, batch := range batches(accountIDs) {
+		params := url.Values{}
+		params.Set("account_id", joinIDs(batch))
+
+		var data map[string]*AccountInfoData
+		if _, err := a.call(ctx, region, "/wot/account/info/", params, &data); err != nil {
+			return nil, err
+		}
+
+		// API returns null for unknown account
+		for _, info := range data {
+			if info != nil {
+				infos[info.AccountID] = newAccountInfo(info)
+			}
+		}
+	}
+
+	return infos, nil
+}
+
+func newAccountInfo(info *AccountInfoData) *domain.AccountInfo {
+	all := info.Statistics.All
+	return &domain.AccountInfo{
+		AccountID:       info.AccountID,
+		Nickname:        info.Nickname,
+		GlobalRating:    info.GlobalRating,
+		LastBattleTime:  time.Unix(info.LastBattleTime, 0),
+		Battles:         all.Battles,
+		Wins:            all.Wins,
+		Losses:          all.Losses,
+		Draws:           all.Draws,
+		DamageDealt:     all.DamageDealt,
+		Frags:           all.Frags,
+		Spotted:         all.Spotted,
+		SurvivedBattles: all.SurvivedBattles,
+		HitsPercents:    all.HitsPercents,
+		MaxXP:           all.MaxXP,
+	}
+}
+
+func (a *adapter) GetVehicles(ctx context.Context, region domain.Region) ([]*domain.Vehicle, error) {
+	// Names are localized, so every region gets its main language
+	lang := "en"
+	if region == domain.RegionRU {
+		lang = "ru"
+	}
+
+	vehicles := make([]*domain.Vehicle, 0)
+	for page := 1; ; page++ {
+		params := url.Values{}
+		params.Set("language", lang)
+		params.Set("fields", "tank_id,name,short_name,tier,type,nation")
+		params.Set("page_no", strconv.Itoa(page))
+
+		var data map[string]*VehicleData
+		meta, err := a.call(ctx, region, "/wot/encyclopedia/vehicles/", params, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range data {
+			if v == nil {
+				continue
+			}
+
+			vehicles = append(vehicles, &domain.Vehicle{
+				Region:    region,
+				TankID:    v.TankID,
+				Name:      v.Name,
+				ShortName: v.ShortName,
+				Tier:      v.Tier,
+				Type:      v.Type,
+				Nation:    v.Nation,
+			})
+		}
+
+		if meta == nil || page >= meta.PageTotal {
+			break
+		}
+	}
+
+	return vehicles, nil
+}
+
+func (a *adapter) GetTankStats(ctx context.Context, region domain.Region, accountID int, tankID int) (*domain.TankStats, error) {
+	params := url.Values{}
+	params.Set("account_id", strconv.Itoa(accountID))
+	params.Set("tank_id", strconv.Itoa(tankID))
+
+	var data map[string][]*TankStatsData
+	if _, err := a.call(ctx, region, "/wot/tanks/stats/", params, &data); err != nil {
+		return nil, err
+	}
+
+	// API returns null if player has never played on the vehicle
+	tt := data[strconv.Itoa(accountID)]
+	if len(tt) == 0 || tt[0] == nil {
+		return nil, domain.ErrTankStatsNotFound
+	}
+
+	return newTankStats(tt[0]), nil
+}
+
+func (a *adapter) FindClan(ctx context.Context, region domain.Region, tag string) (int, error) {
+	params := url.Values{}
+	params.Set("search", tag)
+	params.Set("fields", "clan_id,tag")
+
+	var cc []*ClanData
+	if _, err := a.call(ctx, region, "/wot/clans/list/", params, &cc); err != nil {
+		return 0, err
+	}
+
+	// Search matches names too, so only exact tag is taken
+	for _, c := range cc {
+		if strings.EqualFold(c.Tag, tag) {
+			return c.ClanID, nil
+		}
+	}
+
+	return 0, domain.ErrClanNotFound
+}
+
+func (a *adapter) GetClanInfo(ctx context.Context, region domain.Region, clanID int) (*domain.Clan, error) {
+	params := url.Values{}
+	params.Set("clan_id", strconv.Itoa(clanID))
+
+	var data map[string]*ClanData
+	if _, err := a.call(ctx, region, "/wot/clans/info/", params, &data); err != nil {
+		return nil, err
+	}
+
+	c, ok := data[strconv.Itoa(clanID)]
+	if !ok || c == nil {
+		return nil, domain.ErrClanNotFound
+	}
+
+	clan := &domain.Clan{
+		ClanID:       c.ClanID,
+		Tag:          c.Tag,
+		Name:         c.Name,
+		MembersCount: c.MembersCount,
+		LeaderName:   c.LeaderName,
+		CreatedAt:    time.Unix(c.CreatedAt, 0),
+		Members:      make([]*domain.ClanMember, 0, len(c.Members)),
+	}
+	for _, m := range c.Members {
+		clan.Members = append(clan.Members, &domain.ClanMember{
+			Region:    region,
+			ClanID:    c.ClanID,
+			AccountID: m.AccountID,
+			Nickname:  m.AccountName,
+			Role:      m.Role,
+		})
+	}
+
+	return clan, nil
+}
+
+func (a *adapter) GetTanksStats(ctx context.Context, region domain.Region, accountID int) ([]*domain.TankStats, error) {
+	stats, err := a.GetAccountsTanksStats(ctx, region, []int{accountID})
 	if err != nil {
-		a.logger.Error("Error creating new Wargaming API request!", zap.Error(err))
-		return "", 0, domain.ErrInternalWargaming
+		return nil, err
+	}
+
+	if ss, ok := stats[accountID]; ok {
+		return ss, nil
+	}
+
+	return make([]*domain.TankStats, 0), nil
+}
+
+// GetAccountsTanksStats requests stats of all vehicles of accounts by batches, unknown accounts are missing in result
+func (a *adapter) GetAccountsTanksStats(ctx context.Context, region domain.Region, accountIDs []int) (map[int][]*domain.TankStats, error) {
+	stats := make(map[int][]*domain.TankStats, len(accountIDs))
+	for _, batch := range batches(accountIDs) {
+		params := url.Values{}
+		params.Set("account_id", joinIDs(batch))
+
+		var data map[string][]*TankStatsData
+		if _, err := a.call(ctx, region, "/wot/tanks/stats/", params, &data); err != nil {
+			return nil, err
+		}
+
+		for key, tt := range data {
+			accountID, err := strconv.Atoi(key)
+			if err != nil || tt == nil {
+				continue
+			}
+
+			ss := make([]*domain.TankStats, 0, len(tt))
+			for _, t := range tt {
+				if t != nil {
+					ss = append(ss, newTankStats(t))
+				}
+			}
+			stats[accountID] = ss
+		}
+	}
+
+	return stats, nil
+}
+
+// batches splits account IDs by API limit of one request
+func batches(accountIDs []int) [][]int {
+	var bb [][]int
+	for len(accountIDs) > accountIDsLimit {
+		bb = append(bb, accountIDs[:accountIDsLimit])
+		accountIDs = accountIDs[accountIDsLimit:]
+	}
+	if len(accountIDs) != 0 {
+		bb = append(bb, accountIDs)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), a.config.HTTPTimeout)
+	return bb
+}
+
+func joinIDs(ids []int) string {
+	ss := make([]string, 0, len(ids))
+	for _, id := range ids {
+		ss = append(ss, strconv.Itoa(id))
+	}
+
+	return strings.Join(ss, ",")
+}
+
+func newTankStats(t *TankStatsData) *domain.TankStats {
+	return &domain.TankStats{
+		TankID:               t.TankID,
+		MarkOfMastery:        t.MarkOfMastery,
+		Battles:              t.All.Battles,
+		Wins:                 t.All.Wins,
+		DamageDealt:          t.All.DamageDealt,
+		Frags:                t.All.Frags,
+		Spotted:              t.All.Spotted,
+		DroppedCapturePoints: t.All.DroppedCapturePoints,
+		SurvivedBattles:      t.All.SurvivedBattles,
+	}
+}
+
+// call does request to Wargaming API method and decodes response data into v.
+// Requests are limited by application_id, the ones rejected by API limit anyway are sent again.
+func (a *adapter) call(ctx context.Context, region domain.Region, method string, params url.Values, v interface{}) (*Meta, error) {
+	host, ok := apiHosts[region]
+	if !ok {
+		return nil, domain.ErrUnknownRegion
+	}
+
+	applicationID := a.applicationID(region)
+	params.Set("application_id", applicationID)
+	l := limiterOf(applicationID, a.config.RPS)
+
+	for attempt := 0; ; attempt++ {
+		if err := l.wait(ctx); err != nil {
+			domain.Logger(ctx, a.logger).Error("Error waiting for Wargaming API rate limit!", zap.String("method", method), zap.Error(err))
+			return nil, domain.ErrInternalWargaming
+		}
+
+		start := time.Now()
+		meta, err := a.doWithTimeout(ctx, host, method, params, v)
+		metrics.ObserveUpstream("wargaming", metrics.Outcome(err), start)
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Message == requestLimitExceeded && attempt < requestLimitRetries {
+			domain.Logger(ctx, a.logger).Warn("Wargaming API request limit exceeded, retrying!", zap.String("method", method))
+			continue
+		}
+		if err != nil {
+			if apiErr != nil {
+				domain.Logger(ctx, a.logger).Error("Wargaming API returned an error!", zap.String("method", method), zap.Error(apiErr))
+				return nil, domain.ErrInternalWargaming
+			}
+			return nil, err
+		}
+
+		return meta, nil
+	}
+}
+
+// doWithTimeout does single request, timeout starts after the limiter wait, so time in queue isn't counted
+func (a *adapter) doWithTimeout(ctx context.Context, host string, method string, params url.Values, v interface{}) (*Meta, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.config.HTTPTimeout)
 	defer cancel()
-	req = req.WithContext(ctx)
 
-	q := req.URL.Query()
-	q.Set("application_id", a.config.ApplicationID)
-	q.Set("search", nickname)
-	req.URL.RawQuery = q.Encode()
+	return a.do(ctx, host, method, params, v)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// do does single request, API error is returned as is, other errors are logged and replaced with domain ones
+func (a *adapter) do(ctx context.Context, host string, method string, params url.Values, v interface{}) (*Meta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+method, nil)
 	if err != nil {
-		a.logger.Error("Error doing Wargaming API request!", zap.Error(err))
-		return "", 0, domain.ErrInternalWargaming
+		domain.Logger(ctx, a.logger).Error("Error creating new Wargaming API request!", zap.Error(err))
+		return nil, domain.ErrInternalWargaming
+	}
+	req.URL.RawQuery = params.Encode()
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		domain.Logger(ctx, a.logger).Error("Error doing Wargaming API request!", zap.String("method", method), zap.Error(err))
+		if errors.Is(err, httpclient.ErrCircuitOpen) {
+			return nil, &domain.UnavailableError{Err: domain.ErrInternalWargaming}
+		}
+		return nil, domain.ErrInternalWargaming
 	}
 	//noinspection GoUnhandledErrorResult
 	defer resp.Body.Close()
 
 	var apiResp Response
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		a.logger.Error("Error decoding Wargaming API response!", zap.Error(err))
-		return "", 0, domain.ErrInternalWargaming
+		domain.Logger(ctx, a.logger).Error("Error decoding Wargaming API response!", zap.String("method", method), zap.Error(err))
+		return nil, domain.ErrInternalWargaming
 	}
 
 	if apiResp.Status != "ok" {
-		a.logger.Error("Wargaming API returned an error!", zap.Error(err))
-		return "", 0, domain.ErrInternalWargaming
-	}
-
-	var pp []PlayerData
-	if err := json.Unmarshal(apiResp.Data, &pp); err != nil {
-		a.logger.Error("Error decoding Wargaming API response!", zap.Error(err))
-		return "", 0, domain.ErrInternalWargaming
+		if apiResp.Error == nil {
+			apiResp.Error = &Error{Message: apiResp.Status}
+		}
+		return nil, apiResp.Error
 	}
 
-	for _, p := range pp {
-		if strings.ToLower(p.Nickname) == strings.ToLower(nickname) {
-			return p.Nickname, p.AccountID, nil
-		}
+	if err := json.Unmarshal(apiResp.Data, v); err != nil {
+		domain.Logger(ctx, a.logger).Error("Error decoding Wargaming API response!", zap.String("method", method), zap.Error(err))
+		return nil, domain.ErrInternalWargaming
 	}
 
-	return "", 0, domain.ErrPlayerNotFound
+	return apiResp.Meta, nil
 }
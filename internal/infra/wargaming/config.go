@@ -3,6 +3,8 @@ package wargaming
 import "time"
 
 type Config struct {
-	ApplicationID string        `long:"application-id" env:"APPLICATION_ID" description:"Wargaming API application_id" required:"yes"`
-	HTTPTimeout   time.Duration `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP Wargaming API call timeout" default:"10s"`
+	ApplicationID  string            `long:"application-id" env:"APPLICATION_ID" description:"Wargaming API application_id" required:"yes"`
+	ApplicationIDs map[string]string `long:"application-ids" env:"APPLICATION_IDS" env-delim:"," description:"Per-region application_id overrides (e.g. eu:xxx,na:yyy)"`
+	HTTPTimeout    time.Duration     `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP Wargaming API call timeout" default:"10s"`
+	RPS            int               `long:"rps" env:"RPS" description:"Requests per second per application_id, zero disables limiting" default:"10"`
 }
@@ -0,0 +1,70 @@
+package wargaming
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Wargaming counts requests by application_id, so limiters are shared by the whole process
+var limiters = struct {
+	sync.Mutex
+	m map[string]*limiter
+}{m: make(map[string]*limiter)}
+
+// limiter spaces requests evenly, every request reserves the next free slot
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// limiterOf returns limiter of application_id, nil means requests aren't limited
+func limiterOf(applicationID string, rps int) *limiter {
+	if rps <= 0 {
+		return nil
+	}
+
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.m[applicationID]
+	if !ok {
+		l = &limiter{interval: time.Second / time.Duration(rps)}
+		limiters.m[applicationID] = l
+	}
+
+	return l
+}
+
+// wait blocks until request may be sent, slot of cancelled request is lost
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	d := slot.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -8,9 +8,16 @@ import (
 type Response struct {
 	Status string          `json:"status"`
 	Error  *Error          `json:"error"`
+	Meta   *Meta           `json:"meta"`
 	Data   json.RawMessage `json:"data"`
 }
 
+type Meta struct {
+	Count     int `json:"count"`
+	PageTotal int `json:"page_total"`
+	Page      int `json:"page"`
+}
+
 type Error struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -32,3 +39,67 @@ type PlayerData struct {
 	Nickname  string `json:"nickname"`
 	AccountID int    `json:"account_id"`
 }
+
+type AccountInfoData struct {
+	AccountID      int    `json:"account_id"`
+	Nickname       string `json:"nickname"`
+	GlobalRating   int    `json:"global_rating"`
+	LastBattleTime int64  `json:"last_battle_time"`
+	Statistics     struct {
+		All StatisticsData `json:"all"`
+	} `json:"statistics"`
+}
+
+type StatisticsData struct {
+	Battles         int `json:"battles"`
+	Wins            int `json:"wins"`
+	Losses          int `json:"losses"`
+	Draws           int `json:"draws"`
+	DamageDealt     int `json:"damage_dealt"`
+	Frags           int `json:"frags"`
+	Spotted         int `json:"spotted"`
+	SurvivedBattles int `json:"survived_battles"`
+	HitsPercents    int `json:"hits_percents"`
+	MaxXP           int `json:"max_xp"`
+}
+
+type VehicleData struct {
+	TankID    int    `json:"tank_id"`
+	Name      string `json:"name"`
+	ShortName string `json:"short_name"`
+	Tier      int    `json:"tier"`
+	Type      string `json:"type"`
+	Nation    string `json:"nation"`
+}
+
+type TankStatsData struct {
+	TankID        int                `json:"tank_id"`
+	MarkOfMastery int                `json:"mark_of_mastery"`
+	All           TankStatisticsData `json:"all"`
+}
+
+type TankStatisticsData struct {
+	Battles              int `json:"battles"`
+	Wins                 int `json:"wins"`
+	DamageDealt          int `json:"damage_dealt"`
+	Frags                int `json:"frags"`
+	Spotted              int `json:"spotted"`
+	DroppedCapturePoints int `json:"dropped_capture_points"`
+	SurvivedBattles      int `json:"survived_battles"`
+}
+
+type ClanData struct {
+	ClanID       int               `json:"clan_id"`
+	Tag          string            `json:"tag"`
+	Name         string            `json:"name"`
+	MembersCount int               `json:"members_count"`
+	LeaderName   string            `json:"leader_name"`
+	CreatedAt    int64             `json:"created_at"`
+	Members      []*ClanMemberData `json:"members"`
+}
+
+type ClanMemberData struct {
+	AccountID   int    `json:"account_id"`
+	AccountName string `json:"account_name"`
+	Role        string `json:"role"`
+}
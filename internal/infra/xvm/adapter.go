@@ -2,16 +2,14 @@ package xvm
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net"
+	"errors"
 	"net/http"
-	"net/url"
-	"regexp"
-
-	"github.com/chromedp/chromedp"
+	"time"
 
 	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/infra/chart"
+	"github.com/L11R/wotbot/internal/infra/httpclient"
+	"github.com/L11R/wotbot/internal/infra/metrics"
 	"github.com/PuerkitoBio/goquery"
 	"go.uber.org/zap"
 )
@@ -19,42 +17,60 @@ import (
 type adapter struct {
 	logger *zap.Logger
 	config *Config
+	client *httpclient.Client
 }
 
-func NewAdapter(logger *zap.Logger, config *Config) domain.XVM {
+func NewAdapter(logger *zap.Logger, config *Config, client *httpclient.Client) domain.XVM {
 	a := &adapter{
 		logger: logger,
 		config: config,
+		client: client,
 	}
 
 	return a
 }
 
+func (a *adapter) GetStats(ctx context.Context, region domain.Region, accountID int, withTrend bool) ([]*domain.XVMStat, error) {
+	start := time.Now()
+	ss, err := a.getStats(ctx, region, accountID, withTrend)
+	metrics.ObserveUpstream("xvm", metrics.Outcome(err), start)
+
+	return ss, err
+}
+
 //noinspection GoUnhandledErrorResult
-func (a *adapter) GetStats(accountID int, withTrend bool) ([]*domain.XVMStat, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://stats.modxvm.com/ru/stat/players/"+fmt.Sprint(accountID), nil)
+func (a *adapter) getStats(ctx context.Context, region domain.Region, accountID int, withTrend bool) ([]*domain.XVMStat, error) {
+	req, err := http.NewRequest(http.MethodGet, domain.XVMPlayerURL(region, accountID), nil)
 	if err != nil {
-		a.logger.Error("Error creating new XVM stats request!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error creating new XVM stats request!", zap.Error(err))
 		return nil, domain.ErrInternalXVM
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), a.config.HTTPTimeout)
+	ctx, cancel := context.WithTimeout(ctx, a.config.HTTPTimeout)
 	defer cancel()
 	req = req.WithContext(ctx)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.client.Do(req)
 	if err != nil {
-		a.logger.Error("Error doing XVM stats request!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error doing XVM stats request!", zap.Error(err))
+		if errors.Is(err, httpclient.ErrCircuitOpen) {
+			return nil, &domain.UnavailableError{Err: domain.ErrInternalXVM}
+		}
 		return nil, domain.ErrInternalXVM
 	}
 	defer resp.Body.Close()
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		a.logger.Error("Error creating document from reader!", zap.Error(err))
+		domain.Logger(ctx, a.logger).Error("Error creating document from reader!", zap.Error(err))
 		return nil, domain.ErrInternalXVM
 	}
 
+	return a.parseStats(ctx, doc, withTrend)
+}
+
+// parseStats collects stats from XVM player page and renders their charts if needed
+func (a *adapter) parseStats(ctx context.Context, doc *goquery.Document, withTrend bool) ([]*domain.XVMStat, error) {
 	var ss []*domain.XVMStat
 	doc.Find(".stats-summary a").Each(func(i int, selection *goquery.Selection) {
 		id, ok := selection.Attr("href")
@@ -82,12 +98,10 @@ func (a *adapter) GetStats(accountID int, withTrend bool) ([]*domain.XVMStat, er
 		id = "#" + id
 
 		// Parse chart title from JS script
-		r := regexp.MustCompile(`text: "(.+)"`)
-		match := r.FindStringSubmatch(selection.Find("script").Text())
-		if len(match) != 2 {
+		name := chartTitle(selection.Find("script").Text())
+		if name == "" {
 			return
 		}
-		name := match[1]
 
 		ss = append(ss, &domain.XVMStat{
 			Type:   domain.XVMVehicleStat,
@@ -97,81 +111,26 @@ func (a *adapter) GetStats(accountID int, withTrend bool) ([]*domain.XVMStat, er
 	})
 
 	if withTrend {
-		tt := chromedp.Tasks{
-			chromedp.EmulateViewport(1920, 7666),
-			chromedp.Navigate("https://stats.modxvm.com/ru/stat/players/" + fmt.Sprint(accountID)),
-		}
 		for i := range ss {
-			tt = append(
-				tt,
-				chromedp.Screenshot(ss[i].HtmlID, &ss[i].Image, chromedp.NodeVisible, chromedp.ByID),
-			)
-		}
-
-		timeoutCtx, cancel := context.WithTimeout(context.Background(), a.config.DevtoolsTimeout)
-		defer cancel()
-		debuggerURL, err := a.getWebSocketDebuggerURL()
-		if err != nil {
-			return nil, err
-		}
-		remoteAllocatorCtx, cancel := chromedp.NewRemoteAllocator(timeoutCtx, debuggerURL)
-		defer cancel()
-		ctx, cancel = chromedp.NewContext(remoteAllocatorCtx)
-		defer cancel()
-
-		if err := chromedp.Run(ctx, tt); err != nil {
-			a.logger.Error("Error while taking screenshot!", zap.Error(err))
-			return nil, domain.ErrInternalXVM
+			c, err := parseChart(findScript(doc, ss[i].HtmlID))
+			if err != nil {
+				domain.Logger(ctx, a.logger).Error("Error parsing chart data!", zap.String("html_id", ss[i].HtmlID), zap.Error(err))
+				return nil, domain.ErrInternalXVM
+			}
+
+			if c.Title == "" {
+				c.Title = ss[i].Name
+			}
+
+			start := time.Now()
+			ss[i].Image, err = chart.Render(c, a.config.ChartWidth, a.config.ChartHeight)
+			metrics.ObserveChartRender(metrics.Outcome(err), start)
+			if err != nil {
+				domain.Logger(ctx, a.logger).Error("Error rendering chart!", zap.String("html_id", ss[i].HtmlID), zap.Error(err))
+				return nil, domain.ErrInternalXVM
+			}
 		}
 	}
 
 	return ss, nil
 }
-
-func (a *adapter) getWebSocketDebuggerURL() (string, error) {
-	// Chrome could not resolve local docker service name :\
-	u, err := url.Parse(a.config.ChromeDevtoolsURL)
-	if err != nil {
-		a.logger.Error("Error parsing Chrome Devtools URL!", zap.Error(err))
-		return "", domain.ErrInternalXVM
-	}
-	tcpAddr, err := net.ResolveTCPAddr("tcp", u.Host)
-	if err != nil {
-		a.logger.Error("Error resolving Chrome Devtools host!", zap.Error(err))
-		return "", domain.ErrInternalXVM
-	}
-	u.Host = tcpAddr.String()
-
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
-	if err != nil {
-		a.logger.Error("Error creating new Chrome Devtools request!", zap.Error(err))
-		return "", domain.ErrInternalXVM
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), a.config.DevtoolsTimeout)
-	defer cancel()
-	req = req.WithContext(ctx)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		a.logger.Error("Error doing XVM stats request!", zap.Error(err))
-		return "", domain.ErrInternalXVM
-	}
-	//noinspection GoUnhandledErrorResult
-	defer resp.Body.Close()
-
-	var target []struct {
-		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&target); err != nil {
-		a.logger.Error("Error decoding Chrome Devtools response!", zap.Error(err))
-		return "", domain.ErrInternalXVM
-	}
-
-	if len(target) != 1 {
-		a.logger.Error("Received an empty targets array!")
-		return "", domain.ErrInternalXVM
-	}
-
-	return target[0].WebSocketDebuggerURL, nil
-}
@@ -0,0 +1,85 @@
+package xvm
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/PuerkitoBio/goquery"
+	"go.uber.org/zap"
+)
+
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func TestParseStats(t *testing.T) {
+	a := &adapter{logger: zap.NewNop(), config: &Config{ChartWidth: 400, ChartHeight: 300}}
+
+	ss, err := a.parseStats(context.Background(), loadFixture(t, "player.html"), false)
+	if err != nil {
+		t.Fatalf("parseStats() error: %v", err)
+	}
+
+	want := []struct {
+		typ    domain.XVMStatType
+		name   string
+		value  string
+		htmlID string
+	}{
+		{domain.XVMTrendStat, "Процент побед", "52,3%", "#winrateTrend"},
+		{domain.XVMTrendStat, "Бои", "1 580", "#battlesTrend"},
+		{domain.XVMVehicleStat, "Battles by tier", "", "#battlesByTier"},
+	}
+	if len(ss) != len(want) {
+		t.Fatalf("parseStats() returned %d stats, want %d", len(ss), len(want))
+	}
+	for i, w := range want {
+		s := ss[i]
+		var value string
+		if s.Value != nil {
+			value = *s.Value
+		}
+		if s.Type != w.typ || s.Name != w.name || value != w.value || s.HtmlID != w.htmlID {
+			t.Errorf("stat %d = {%v %q %q %q}, want %+v", i, s.Type, s.Name, value, s.HtmlID, w)
+		}
+		if s.Image != nil {
+			t.Errorf("stat %d has chart without trend requested", i)
+		}
+	}
+}
+
+func TestParseStatsWithTrend(t *testing.T) {
+	a := &adapter{logger: zap.NewNop(), config: &Config{ChartWidth: 400, ChartHeight: 300}}
+
+	ss, err := a.parseStats(context.Background(), loadFixture(t, "player.html"), true)
+	if err != nil {
+		t.Fatalf("parseStats() error: %v", err)
+	}
+
+	for _, s := range ss {
+		img, err := png.Decode(bytes.NewReader(s.Image))
+		if err != nil {
+			t.Fatalf("chart of %s isn't PNG: %v", s.HtmlID, err)
+		}
+		if b := img.Bounds(); b.Dx() != 400 || b.Dy() != 300 {
+			t.Errorf("chart of %s is %dx%d, want 400x300", s.HtmlID, b.Dx(), b.Dy())
+		}
+	}
+}
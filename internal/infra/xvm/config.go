@@ -3,7 +3,7 @@ package xvm
 import "time"
 
 type Config struct {
-	ChromeDevtoolsURL string        `long:"chrome-devtools-url" env:"CHROME_DEVTOOLS_URL" description:"Chrome Devtools URL" required:"yes"`
-	HTTPTimeout       time.Duration `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP XVM webpage call timeout" default:"10s"`
-	DevtoolsTimeout   time.Duration `long:"devtools-timeout" env:"DEVTOOLS_TIMEOUT" description:"Devtools XVM webpage call timeout" default:"10s"`
+	HTTPTimeout time.Duration `long:"http-timeout" env:"HTTP_TIMEOUT" description:"HTTP XVM webpage call timeout" default:"10s"`
+	ChartWidth  int           `long:"chart-width" env:"CHART_WIDTH" description:"Width of rendered trend charts" default:"800"`
+	ChartHeight int           `long:"chart-height" env:"CHART_HEIGHT" description:"Height of rendered trend charts" default:"400"`
 }
@@ -0,0 +1,282 @@
+package xvm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/L11R/wotbot/internal/infra/chart"
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	chartTypeRegexp    = regexp.MustCompile(`type\s*:\s*['"](\w+)['"]`)
+	chartTitleRegexp   = regexp.MustCompile(`(?:^|[^\w$])text\s*:\s*['"]`)
+	chartLabelsRegexp  = regexp.MustCompile(`(?:^|[^\w$])labels\s*:\s*\[`)
+	chartDataRegexp    = regexp.MustCompile(`(?:^|[^\w$])data\s*:\s*\[`)
+	chartDatasetRegexp = regexp.MustCompile(`(?:^|[^\w$])label\s*:\s*['"]`)
+)
+
+// findScript returns inline script which draws the canvas with passed HTML ID (e.g. #winrateTrend)
+func findScript(doc *goquery.Document, htmlID string) string {
+	if script := doc.Find(htmlID).Parent().Find("script").Text(); script != "" {
+		return script
+	}
+
+	// Fallback for the case when the script isn't placed next to canvas
+	id := strings.TrimPrefix(htmlID, "#")
+	var script string
+	doc.Find("script").EachWithBreak(func(i int, selection *goquery.Selection) bool {
+		text := selection.Text()
+		if strings.Contains(text, `"`+id+`"`) || strings.Contains(text, `'`+id+`'`) {
+			script = text
+			return false
+		}
+		return true
+	})
+
+	return script
+}
+
+// chartTitle returns title of Chart.js config, empty string if there is no one
+func chartTitle(script string) string {
+	loc := chartTitleRegexp.FindStringIndex(script)
+	if loc == nil {
+		return ""
+	}
+
+	title, _ := jsString(script, loc[1]-1)
+	return title
+}
+
+// parseChart extracts Chart.js config values from inline script
+func parseChart(script string) (*chart.Chart, error) {
+	c := &chart.Chart{Type: chart.Line, Title: chartTitle(script)}
+
+	if match := chartTypeRegexp.FindStringSubmatch(script); len(match) == 2 && match[1] != "line" {
+		// Pies, doughnuts and others are drawn as bars, they are easier to read anyway
+		c.Type = chart.Bar
+	}
+
+	if loc := chartLabelsRegexp.FindStringIndex(script); loc != nil {
+		var labels []interface{}
+		if err := unmarshalJS(jsLiteral(script, loc[1]-1), &labels); err != nil {
+			return nil, fmt.Errorf("parsing chart labels: %w", err)
+		}
+
+		for _, l := range labels {
+			c.Labels = append(c.Labels, label(l))
+		}
+	}
+
+	var names []string
+	for _, loc := range chartDatasetRegexp.FindAllStringIndex(script, -1) {
+		name, _ := jsString(script, loc[1]-1)
+		names = append(names, name)
+	}
+
+	for i, loc := range chartDataRegexp.FindAllStringIndex(script, -1) {
+		var points []interface{}
+		if err := unmarshalJS(jsLiteral(script, loc[1]-1), &points); err != nil {
+			return nil, fmt.Errorf("parsing chart data: %w", err)
+		}
+
+		ds := &chart.Dataset{}
+		if i < len(names) {
+			ds.Label = names[i]
+		}
+
+		withLabels := len(c.Labels) != 0
+		for _, p := range points {
+			// Time series could be passed as {x: ..., y: ...} points instead of separate labels
+			if obj, ok := p.(map[string]interface{}); ok {
+				if !withLabels && i == 0 {
+					c.Labels = append(c.Labels, label(obj["x"]))
+				}
+				p = obj["y"]
+			}
+
+			v, err := toFloat(p)
+			if err != nil {
+				return nil, err
+			}
+			ds.Values = append(ds.Values, v)
+		}
+
+		c.Datasets = append(c.Datasets, ds)
+	}
+
+	if len(c.Labels) == 0 || len(c.Datasets) == 0 {
+		return nil, fmt.Errorf("chart data not found")
+	}
+
+	return c, nil
+}
+
+// label formats axis label, multiline labels are passed as arrays of lines
+func label(v interface{}) string {
+	if lines, ok := v.([]interface{}); ok {
+		parts := make([]string, 0, len(lines))
+		for _, l := range lines {
+			parts = append(parts, fmt.Sprint(l))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	return fmt.Sprint(v)
+}
+
+// jsLiteral returns JS array or object literal which starts at i, brackets inside of strings are skipped
+func jsLiteral(script string, i int) string {
+	depth := 0
+	for j := i; j < len(script); j++ {
+		switch script[j] {
+		case '"', '\'', '`':
+			j = skipString(script, j)
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return script[i : j+1]
+			}
+		}
+	}
+
+	// Unbalanced literal is left to JSON decoder to report
+	return script[i:]
+}
+
+// skipString returns index of quote closing JS string which starts at i
+func skipString(script string, i int) int {
+	quote := script[i]
+	for j := i + 1; j < len(script); j++ {
+		switch script[j] {
+		case '\\':
+			j++
+		case quote:
+			return j
+		}
+	}
+
+	return len(script)
+}
+
+// jsString decodes JS string literal which starts at i
+func jsString(script string, i int) (string, error) {
+	var s string
+	err := unmarshalJS(script[i:skipString(script, i)+1], &s)
+	return s, err
+}
+
+// unmarshalJS decodes JS literal which is close enough to JSON: strings may be single-quoted,
+// object keys may be unquoted and trailing commas are allowed
+func unmarshalJS(literal string, v interface{}) error {
+	var b strings.Builder
+	for i := 0; i < len(literal); i++ {
+		ch := literal[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			end := skipString(literal, i)
+			writeJSONString(&b, literal[i+1:min(end, len(literal))])
+			i = end
+		case ch == ',':
+			// Trailing comma is dropped
+			j := i + 1
+			for j < len(literal) && isSpace(literal[j]) {
+				j++
+			}
+			if j < len(literal) && (literal[j] == ']' || literal[j] == '}') {
+				continue
+			}
+			b.WriteByte(ch)
+		case isIdentStart(ch):
+			j := i + 1
+			for j < len(literal) && (isIdentStart(literal[j]) || literal[j] >= '0' && literal[j] <= '9') {
+				j++
+			}
+			ident := literal[i:j]
+
+			k := j
+			for k < len(literal) && isSpace(literal[k]) {
+				k++
+			}
+			switch {
+			case k < len(literal) && literal[k] == ':':
+				b.WriteString(strconv.Quote(ident))
+			case ident == "undefined":
+				b.WriteString("null")
+			default:
+				b.WriteString(ident)
+			}
+			i = j - 1
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return json.Unmarshal([]byte(b.String()), v)
+}
+
+// writeJSONString writes body of JS string as JSON string, escapes which JSON doesn't know are unescaped
+func writeJSONString(b *strings.Builder, body string) {
+	b.WriteByte('"')
+	for i := 0; i < len(body); i++ {
+		switch ch := body[i]; {
+		case ch == '\\' && i+1 < len(body):
+			i++
+			switch next := body[i]; next {
+			case '\'':
+				b.WriteByte('\'')
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't', 'u':
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			default:
+				b.WriteByte(next)
+			}
+		case ch == '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+}
+
+func isIdentStart(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$'
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case nil:
+		// Chart.js leaves a gap for null, so does the chart package for NaN
+		return math.NaN(), nil
+	case []interface{}:
+		// Floating bars are passed as [from, to], the top is drawn
+		if len(v) == 0 {
+			return math.NaN(), nil
+		}
+		return toFloat(v[len(v)-1])
+	default:
+		return 0, fmt.Errorf("unexpected chart value: %v", v)
+	}
+}
@@ -0,0 +1,134 @@
+package xvm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/L11R/wotbot/internal/infra/chart"
+)
+
+func TestUnmarshalJS(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string
+		want    interface{}
+	}{
+		{"json", `[1, "a", null]`, []interface{}{1.0, "a", nil}},
+		{"single quotes", `['a', 'b']`, []interface{}{"a", "b"}},
+		{"apostrophe", `['Player\'s', "it's"]`, []interface{}{"Player's", "it's"}},
+		{"double quote inside single quotes", `['say "hi"']`, []interface{}{`say "hi"`}},
+		{"unquoted keys", `{x: 1, $y: 2, "z": 3}`, map[string]interface{}{"x": 1.0, "$y": 2.0, "z": 3.0}},
+		{"key-like text in string", `['a, b: c', '{d: e}']`, []interface{}{"a, b: c", "{d: e}"}},
+		{"trailing commas", `[{x: 1,}, 2, ]`, []interface{}{map[string]interface{}{"x": 1.0}, 2.0}},
+		{"nested arrays", `[['Mar', '2020'], [1, [2]]]`, []interface{}{[]interface{}{"Mar", "2020"}, []interface{}{1.0, []interface{}{2.0}}}},
+		{"undefined", `[undefined, true]`, []interface{}{nil, true}},
+		{"escapes", `['a\nb', 'A']`, []interface{}{"a\nb", "A"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := unmarshalJS(tt.literal, &got); err != nil {
+				t.Fatalf("unmarshalJS(%q) error: %v", tt.literal, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unmarshalJS(%q) = %#v, want %#v", tt.literal, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSInvalid(t *testing.T) {
+	for _, literal := range []string{`[1, 2`, `[new Date()]`, `['unterminated]`} {
+		var got interface{}
+		if err := unmarshalJS(literal, &got); err == nil {
+			t.Errorf("unmarshalJS(%q) = %#v, want error", literal, got)
+		}
+	}
+}
+
+func TestJSLiteral(t *testing.T) {
+	script := `data: [[1, 2], 'a]', "b[", 3], other: [4]`
+	if got, want := jsLiteral(script, 6), `[[1, 2], 'a]', "b[", 3]`; got != want {
+		t.Errorf("jsLiteral() = %q, want %q", got, want)
+	}
+}
+
+func TestParseChart(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   *chart.Chart
+	}{
+		{
+			name: "labels and datasets",
+			script: `new Chart(ctx, {
+				type: 'line',
+				data: {
+					labels: ['Jan', ['Feb', '2020']],
+					datasets: [{label: 'Player\'s', data: [1, '2']}, {label: "Server", data: [3, 4]}],
+				},
+				options: {title: {text: 'Winrate, %'}},
+			});`,
+			want: &chart.Chart{
+				Type:   chart.Line,
+				Title:  "Winrate, %",
+				Labels: []string{"Jan", "Feb 2020"},
+				Datasets: []*chart.Dataset{
+					{Label: "Player's", Values: []float64{1, 2}},
+					{Label: "Server", Values: []float64{3, 4}},
+				},
+			},
+		},
+		{
+			name:   "points",
+			script: `{type: "pie", data: {datasets: [{label: 'Battles', data: [{x: 'a', y: 1}, {x: 'b', y: 2}]}]}}`,
+			want: &chart.Chart{
+				Type:     chart.Bar,
+				Labels:   []string{"a", "b"},
+				Datasets: []*chart.Dataset{{Label: "Battles", Values: []float64{1, 2}}},
+			},
+		},
+		{
+			name:   "floating bars",
+			script: `{type: 'bar', data: {labels: [1, 2], datasets: [{data: [[0, 10], 20]}]}}`,
+			want: &chart.Chart{
+				Type:     chart.Bar,
+				Labels:   []string{"1", "2"},
+				Datasets: []*chart.Dataset{{Values: []float64{10, 20}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChart(tt.script)
+			if err != nil {
+				t.Fatalf("parseChart() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChart() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChartGaps(t *testing.T) {
+	got, err := parseChart(`{type: 'line', data: {labels: [1, 2, 3], datasets: [{data: [1, null, []]}]}}`)
+	if err != nil {
+		t.Fatalf("parseChart() error: %v", err)
+	}
+
+	// Missing points aren't turned into zeros
+	values := got.Datasets[0].Values
+	if len(values) != 3 || values[0] != 1 || !math.IsNaN(values[1]) || !math.IsNaN(values[2]) {
+		t.Errorf("values = %v, want [1 NaN NaN]", values)
+	}
+}
+
+func TestParseChartNoData(t *testing.T) {
+	if _, err := parseChart(`{type: 'line', data: {labels: []}}`); err == nil {
+		t.Error("parseChart() of chart without data succeeded, want error")
+	}
+}
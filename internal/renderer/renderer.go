@@ -0,0 +1,264 @@
+package renderer
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+)
+
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "markdown"
+	FormatText     Format = "text"
+)
+
+// bestMark marks the leader of compared values in tables
+const bestMark = "★"
+
+// style describes markup of the output format, renderer itself knows nothing about it
+type style struct {
+	escape func(s string) string
+	bold   func(s string) string
+	italic func(s string) string
+	link   func(text, url string) string
+	pre    func(s string) string
+}
+
+var styles = map[Format]*style{
+	FormatHTML: {
+		escape: html.EscapeString,
+		bold:   func(s string) string { return "<b>" + s + "</b>" },
+		italic: func(s string) string { return "<i>" + s + "</i>" },
+		link: func(text, url string) string {
+			return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(url), text)
+		},
+		pre: func(s string) string { return "<pre>" + s + "</pre>" },
+	},
+	// Telegram legacy Markdown, it has no nested entities and escapes with backslash
+	FormatMarkdown: {
+		escape: strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[").Replace,
+		bold:   func(s string) string { return "*" + s + "*" },
+		italic: func(s string) string { return "_" + s + "_" },
+		link: func(text, url string) string {
+			return fmt.Sprintf("[%s](%s)", text, url)
+		},
+		pre: func(s string) string { return "```\n" + s + "\n```" },
+	},
+	FormatText: {
+		escape: func(s string) string { return s },
+		bold:   func(s string) string { return s },
+		italic: func(s string) string { return s },
+		link: func(text, url string) string {
+			return fmt.Sprintf("%s: %s", text, url)
+		},
+		pre: func(s string) string { return s },
+	},
+}
+
+// Renderer turns structured service results into message text
+type Renderer struct {
+	style *style
+	// preEscaped means text inside pre block needs escaping too, Markdown code blocks are taken literally
+	preEscaped bool
+}
+
+// New returns renderer of the format, unknown format falls back to plain text
+func New(format Format) *Renderer {
+	st, ok := styles[format]
+	if !ok {
+		st = styles[FormatText]
+	}
+
+	return &Renderer{
+		style:      st,
+		preEscaped: format == FormatHTML,
+	}
+}
+
+// Render formats result, language is used for renderer's own words only, the rest is translated by service
+func (r *Renderer) Render(lang i18n.Lang, result *domain.Result) string {
+	if result == nil {
+		return ""
+	}
+
+	var blocks []string
+	if result.Header != nil {
+		blocks = append(blocks, r.header(result.Header))
+	}
+	if result.Text != "" {
+		blocks = append(blocks, r.style.escape(result.Text))
+	}
+
+	legend := false
+	for _, section := range result.Sections {
+		// Columns legend goes once before the first table, the rest of tables share it
+		if section.Table != nil && !legend {
+			blocks = append(blocks, r.legend(lang, section.Table))
+			legend = true
+		}
+		if block := r.section(lang, section); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+
+	if result.Footer != "" {
+		blocks = append(blocks, r.style.italic(r.style.escape(result.Footer)))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+func (r *Renderer) header(h *domain.Header) string {
+	line := r.style.bold(r.style.escape(h.Label)+":") + " " + r.style.escape(h.Name)
+	if h.Link != nil {
+		line += " " + r.style.link("("+r.style.escape(h.Link.Text)+")", h.Link.URL)
+	}
+
+	return line
+}
+
+func (r *Renderer) section(lang i18n.Lang, section *domain.Section) string {
+	var lines []string
+	if section.Title != "" {
+		lines = append(lines, r.style.bold(r.style.escape(section.Title)+":"))
+	}
+
+	n := 0
+	for _, stat := range section.Stats {
+		n++
+		if section.Ordered {
+			lines = append(lines, fmt.Sprintf("%d. %s — %s", n, r.style.escape(stat.Name), r.value(lang, stat)))
+		} else {
+			lines = append(lines, r.style.bold(r.style.escape(stat.Name)+":")+" "+r.value(lang, stat))
+		}
+	}
+
+	for _, item := range section.Items {
+		n++
+		if section.Ordered {
+			lines = append(lines, fmt.Sprintf("%d. %s", n, r.style.escape(item)))
+		} else {
+			lines = append(lines, r.style.escape(item))
+		}
+	}
+
+	if len(section.Links) != 0 {
+		links := make([]string, 0, len(section.Links))
+		for _, l := range section.Links {
+			links = append(links, r.style.link(r.style.escape(l.Text), l.URL))
+		}
+		lines = append(lines, strings.Join(links, " | "))
+	}
+
+	if section.Table != nil {
+		lines = append(lines, r.table(section.Table))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// value formats stat value with its grade and delta, changed stats look like "old → new"
+func (r *Renderer) value(lang i18n.Lang, stat *domain.Stat) string {
+	value := r.style.escape(stat.Value)
+	if stat.Previous != "" {
+		value = r.style.escape(stat.Previous) + " → " + value
+	} else if stat.Grade != nil {
+		value = graded(stat.Grade, value)
+	}
+
+	if stat.Delta != nil {
+		value += " " + r.style.escape(delta(stat.Delta))
+	}
+
+	// Grade of changed stat is news by itself
+	if stat.Previous != "" && stat.Grade != nil {
+		if g := strings.TrimSpace(stat.Grade.Emoji + " " + stat.Grade.Label); g != "" {
+			value += r.style.escape(i18n.Sprintf(lang, ", теперь %s", g))
+		}
+	}
+
+	return value
+}
+
+func graded(g *domain.Grade, value string) string {
+	switch {
+	case g.Emoji != "":
+		return g.Emoji + " " + value
+	case g.Label != "":
+		return fmt.Sprintf("%s (%s)", value, g.Label)
+	}
+
+	return value
+}
+
+func delta(d *domain.Delta) string {
+	suffix := ""
+	if d.Percent {
+		suffix = "%"
+	}
+
+	value := strconv.FormatFloat(d.Value, 'f', d.Precision, 64)
+	switch {
+	case d.Value > 0:
+		return "🔺 +" + value + suffix
+	case d.Value < 0:
+		return "🔻 " + value + suffix
+	}
+
+	return "▪️ 0"
+}
+
+func (r *Renderer) legend(lang i18n.Lang, t *domain.Table) string {
+	lines := make([]string, 0, len(t.Columns)+1)
+	for i, column := range t.Columns {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, r.style.escape(column)))
+	}
+	lines = append(lines, i18n.Sprintf(lang, "Значения идут в том же порядке, %s отмечен лучший.", bestMark))
+
+	return strings.Join(lines, "\n")
+}
+
+// table renders rows as monospaced table, row title goes on its own line to fit phone screen
+func (r *Renderer) table(t *domain.Table) string {
+	escape := func(s string) string { return s }
+	if r.preEscaped {
+		escape = r.style.escape
+	}
+
+	var b strings.Builder
+	for _, row := range t.Rows {
+		cells := make([]string, len(row.Cells))
+		width := 0
+		for i, cell := range row.Cells {
+			text := cell.Text
+			switch {
+			case text == "":
+				text = "—"
+			case cell.Best:
+				text += bestMark
+			}
+
+			cells[i] = text
+			if n := utf8.RuneCountInString(text); n > width {
+				width = n
+			}
+		}
+
+		line := ""
+		for _, cell := range cells {
+			line += " " + escape(cell) + strings.Repeat(" ", width-utf8.RuneCountInString(cell)+1)
+		}
+
+		b.WriteString(escape(row.Title) + "\n")
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	return r.style.pre(strings.TrimSuffix(b.String(), "\n"))
+}
@@ -0,0 +1,119 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/L11R/wotbot/internal/domain"
+	"github.com/L11R/wotbot/internal/i18n"
+)
+
+func TestRenderNil(t *testing.T) {
+	if got := New(FormatHTML).Render(i18n.Russian, nil); got != "" {
+		t.Errorf("Render(nil) = %q, want empty", got)
+	}
+}
+
+func TestRenderHTMLEscaping(t *testing.T) {
+	result := &domain.Result{
+		Header: &domain.Header{
+			Label: "Клан",
+			Name:  "[<T>] A&B",
+			Link:  &domain.Link{Text: "сайт", URL: `https://example.com/?a=1&b="2"`},
+		},
+		Sections: []*domain.Section{
+			{
+				Title:   "Лучшие",
+				Ordered: true,
+				Stats:   []*domain.Stat{{Name: "<b>nick</b>", Value: "1 < 2"}},
+			},
+			{Items: []string{"a & b"}},
+		},
+		Footer: "<i>",
+	}
+
+	want := strings.Join([]string{
+		`<b>Клан:</b> [&lt;T&gt;] A&amp;B <a href="https://example.com/?a=1&amp;b=&#34;2&#34;">(сайт)</a>`,
+		"<b>Лучшие:</b>\n1. &lt;b&gt;nick&lt;/b&gt; — 1 &lt; 2",
+		"a &amp; b",
+		"<i>&lt;i&gt;</i>",
+	}, "\n\n")
+
+	if got := New(FormatHTML).Render(i18n.Russian, result); got != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderMarkdownEscaping(t *testing.T) {
+	result := &domain.Result{
+		Header: &domain.Header{Label: "Игрок", Name: "some_nick*"},
+		Sections: []*domain.Section{
+			{Stats: []*domain.Stat{{Name: "WN8", Value: "[1]`"}}},
+		},
+	}
+
+	want := "*Игрок:* some\\_nick\\*\n\n*WN8:* \\[1]\\`"
+	if got := New(FormatMarkdown).Render(i18n.Russian, result); got != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderStatValue(t *testing.T) {
+	result := &domain.Result{
+		Sections: []*domain.Section{{
+			Stats: []*domain.Stat{
+				{Name: "WN8", Value: "2000", Grade: &domain.Grade{Label: "Хорошо", Emoji: "💚"}},
+				{Name: "WTR", Value: "5000", Grade: &domain.Grade{Label: "Средне"}},
+				{Name: "Бои", Value: "110", Previous: "100", Delta: &domain.Delta{Value: 10}, Grade: &domain.Grade{Emoji: "💚"}},
+				{Name: "Урон", Value: "900", Delta: &domain.Delta{Value: -5.5, Precision: 1, Percent: true}},
+			},
+		}},
+	}
+
+	want := strings.Join([]string{
+		"WN8: 💚 2000",
+		"WTR: 5000 (Средне)",
+		"Бои: 100 → 110 🔺 +10, теперь 💚",
+		"Урон: 900 🔻 -5.5%",
+	}, "\n")
+
+	if got := New(FormatText).Render(i18n.Russian, result); got != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	table := &domain.Table{
+		Columns: []string{"a<b", "c"},
+		Rows: []*domain.TableRow{
+			{Title: "WN8 & co", Cells: []*domain.TableCell{{Text: "1500"}, {Text: "2000", Best: true}}},
+			{Title: "WTR", Cells: []*domain.TableCell{{Text: "<1"}, {}}},
+		},
+	}
+	result := &domain.Result{
+		Sections: []*domain.Section{
+			{Title: "KTTC", Table: table},
+			{Title: "XVM", Table: table},
+		},
+	}
+
+	got := New(FormatHTML).Render(i18n.Russian, result)
+
+	// Legend goes once before the first table
+	legend := "1. a&lt;b\n2. c\nЗначения идут в том же порядке, ★ отмечен лучший."
+	if strings.Count(got, legend) != 1 || !strings.HasPrefix(got, legend) {
+		t.Errorf("legend isn't rendered once at the top:\n%s", got)
+	}
+
+	// Cells are padded to the widest one of the row, missing values are dashed
+	wantTable := "<pre>WN8 &amp; co\n 1500   2000★\nWTR\n &lt;1  —</pre>"
+	if strings.Count(got, wantTable) != 2 {
+		t.Errorf("Render() =\n%s\nwant tables\n%s", got, wantTable)
+	}
+
+	// Markdown code blocks are taken literally
+	md := New(FormatMarkdown).Render(i18n.Russian, result)
+	if !strings.Contains(md, "```\nWN8 & co\n 1500   2000★\nWTR\n <1  —\n```") {
+		t.Errorf("Markdown table isn't literal:\n%s", md)
+	}
+}
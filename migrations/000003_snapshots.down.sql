@@ -0,0 +1,15 @@
+-- Only the latest snapshot of every user survives
+DELETE
+FROM stats
+WHERE snapshot_id NOT IN (SELECT DISTINCT ON (user_id) id FROM snapshots ORDER BY user_id, created_at DESC, id DESC);
+
+UPDATE stats
+SET img = ''
+WHERE img IS NULL;
+ALTER TABLE stats
+    ALTER COLUMN img SET NOT NULL;
+
+DROP INDEX stats_snapshot_id_idx;
+ALTER TABLE stats
+    DROP COLUMN snapshot_id;
+DROP TABLE snapshots;
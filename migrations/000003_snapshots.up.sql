@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS snapshots
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS snapshots_user_id_created_at_idx ON snapshots (user_id, created_at);
+
+ALTER TABLE stats
+    ADD snapshot_id BIGINT REFERENCES snapshots (id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+-- Already cached stats become the first snapshot of every user
+INSERT INTO snapshots (user_id, created_at)
+SELECT user_id, min(created_at)
+FROM stats
+GROUP BY user_id;
+
+UPDATE stats
+SET snapshot_id = snapshots.id
+FROM snapshots
+WHERE stats.user_id = snapshots.user_id;
+
+ALTER TABLE stats
+    ALTER COLUMN snapshot_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS stats_snapshot_id_idx ON stats (snapshot_id);
+
+-- Charts are shown for the latest snapshot only, older ones keep values
+ALTER TABLE stats
+    ALTER COLUMN img DROP NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN wargaming_region;
+ALTER TABLE users
+    DROP COLUMN region;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD region TEXT;
+ALTER TABLE users
+    ADD wargaming_region TEXT;
+
+-- Every nickname saved before regions were introduced belongs to RU cluster
+UPDATE users
+SET wargaming_region = 'ru'
+WHERE wargaming_id IS NOT NULL;
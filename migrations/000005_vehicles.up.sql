@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS vehicles
+(
+    region     TEXT        NOT NULL,
+    tank_id    INTEGER     NOT NULL,
+    name       TEXT        NOT NULL,
+    short_name TEXT        NOT NULL,
+    tier       INTEGER     NOT NULL,
+    type       TEXT        NOT NULL,
+    nation     TEXT        NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (region, tank_id)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS clan_members
+(
+    region     TEXT             NOT NULL,
+    clan_id    INTEGER          NOT NULL,
+    account_id INTEGER          NOT NULL,
+    nickname   TEXT             NOT NULL,
+    role       TEXT             NOT NULL,
+    wn8        DOUBLE PRECISION NULL,
+    winrate    DOUBLE PRECISION NULL,
+    updated_at TIMESTAMP        NOT NULL DEFAULT now(),
+    PRIMARY KEY (region, clan_id, account_id)
+);
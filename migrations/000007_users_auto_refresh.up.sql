@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD auto_refresh BOOLEAN;
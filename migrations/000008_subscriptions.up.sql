@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS subscriptions
+(
+    user_id     INTEGER          NOT NULL PRIMARY KEY REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    min_change  DOUBLE PRECISION NOT NULL,
+    snapshot_id BIGINT           NULL REFERENCES snapshots (id) ON UPDATE CASCADE ON DELETE SET NULL,
+    kttc_values JSONB            NULL,
+    created_at  TIMESTAMP        NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMP        NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS chat_members
+(
+    chat_id    BIGINT    NOT NULL,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NULL,
+    PRIMARY KEY (chat_id, user_id)
+);
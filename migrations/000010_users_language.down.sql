@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN language_code;
+ALTER TABLE users
+    DROP COLUMN language;
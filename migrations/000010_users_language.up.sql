@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD language TEXT;
+ALTER TABLE users
+    ADD language_code TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD refreshed_at TIMESTAMP;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS upstream_cache
+(
+    key        TEXT      NOT NULL PRIMARY KEY,
+    value      BYTEA     NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS upstream_cache_expires_at_idx ON upstream_cache (expires_at);